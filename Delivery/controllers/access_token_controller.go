@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Used when a token is created without an expiry
+const defaultAccessTokenDays = 30
+
+type AccessTokenController struct {
+	UseCase Domain.AccessTokenUseCaseI
+}
+
+func NewAccessTokenController(uc Domain.AccessTokenUseCaseI) *AccessTokenController {
+	return &AccessTokenController{
+		UseCase: uc,
+	}
+}
+
+func (TkCtrl *AccessTokenController) CreateAccessTokenController(c *gin.Context) {
+	var body CreateAccessTokenDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.ExpiresInDays == 0 {
+		body.ExpiresInDays = defaultAccessTokenDays
+	}
+	user := c.MustGet("user").(*Domain.User)
+	token, secret, err := TkCtrl.UseCase.CreateAccessTokenUC(user.ID, body.Name, body.Scopes, time.Duration(body.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		msg := err.Error()
+		if strings.HasPrefix(msg, "token ") || strings.HasPrefix(msg, "unknown scope") || msg == "at least one scope is required" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "copy the token now, it will not be shown again",
+		"token":   secret,
+		"details": toAccessTokenDTO(token),
+	})
+}
+
+func (TkCtrl *AccessTokenController) ListAccessTokensController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	tokens, err := TkCtrl.UseCase.ListAccessTokensUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := []AccessTokenDTO{}
+	for _, token := range tokens {
+		result = append(result, toAccessTokenDTO(token))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": result})
+}
+
+func (TkCtrl *AccessTokenController) RevokeAccessTokenController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := TkCtrl.UseCase.RevokeAccessTokenUC(user.ID, c.Param("id")); err != nil {
+		if err.Error() == "access token not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "access token revoked"})
+}
+
+func toAccessTokenDTO(token Domain.AccessToken) AccessTokenDTO {
+	dto := AccessTokenDTO{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if !token.LastUsedAt.IsZero() {
+		dto.LastUsedAt = &token.LastUsedAt
+	}
+	return dto
+}
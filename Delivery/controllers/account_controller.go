@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountController struct {
+	UseCase Domain.AccountUseCaseI
+}
+
+func NewAccountController(uc Domain.AccountUseCaseI) *AccountController {
+	return &AccountController{
+		UseCase: uc,
+	}
+}
+
+func (AcCtrl *AccountController) RequestExportController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	export, err := AcCtrl.UseCase.RequestExportUC(*user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "your export is being prepared, we'll email you once it is ready", "export": toDataExportDTO(export)})
+}
+
+func (AcCtrl *AccountController) ListExportsController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	exports, err := AcCtrl.UseCase.ListExportsUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := []DataExportDTO{}
+	for _, export := range exports {
+		result = append(result, toDataExportDTO(export))
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": result})
+}
+
+func (AcCtrl *AccountController) DownloadExportController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	export, data, err := AcCtrl.UseCase.DownloadExportUC(user.ID, c.Param("id"))
+	if err != nil {
+		switch err.Error() {
+		case "export not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case "export not ready":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": export.Status})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="export-`+export.CreatedAt.Format("2006-01-02")+`.zip"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+func (AcCtrl *AccountController) ScheduleDeletionController(c *gin.Context) {
+	var body DeleteAccountDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	deletion, err := AcCtrl.UseCase.ScheduleDeletionUC(*user, body.Password, body.Posts)
+	if err != nil {
+		switch err.Error() {
+		case "posts must be delete or anonymize":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case "invalid password":
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "your account will be deleted, cancel any time before then", "deletion": toAccountDeletionDTO(deletion)})
+}
+
+func (AcCtrl *AccountController) GetDeletionController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	deletion, err := AcCtrl.UseCase.GetDeletionUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletion": toAccountDeletionDTO(deletion)})
+}
+
+func (AcCtrl *AccountController) CancelDeletionController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := AcCtrl.UseCase.CancelDeletionUC(user.ID); err != nil {
+		if err.Error() == "no deletion scheduled" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "account deletion cancelled"})
+}
+
+func toDataExportDTO(export Domain.DataExport) DataExportDTO {
+	dto := DataExportDTO{
+		ID:        export.ID,
+		Status:    export.Status,
+		Size:      export.Size,
+		CreatedAt: export.CreatedAt,
+		ExpiresAt: export.ExpiresAt,
+	}
+	if !export.FinishedAt.IsZero() {
+		dto.FinishedAt = &export.FinishedAt
+	}
+	return dto
+}
+
+func toAccountDeletionDTO(deletion Domain.AccountDeletion) AccountDeletionDTO {
+	return AccountDeletionDTO{
+		Posts:       deletion.Posts,
+		RequestedAt: deletion.RequestedAt,
+		DeleteAt:    deletion.DeleteAt,
+	}
+}
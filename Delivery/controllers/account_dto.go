@@ -0,0 +1,24 @@
+package controllers
+
+import "time"
+
+type DeleteAccountDTO struct {
+	Password string `json:"password"`
+	// delete or anonymize
+	Posts string `json:"posts" binding:"required"`
+}
+
+type DataExportDTO struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Size       int64      `json:"size"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+type AccountDeletionDTO struct {
+	Posts       string    `json:"posts"`
+	RequestedAt time.Time `json:"requested_at"`
+	DeleteAt    time.Time `json:"delete_at"`
+}
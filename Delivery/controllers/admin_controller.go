@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	UseCase Domain.AdminUseCaseI
+}
+
+func NewAdminController(uc Domain.AdminUseCaseI) *AdminController {
+	return &AdminController{
+		UseCase: uc,
+	}
+}
+
+// ListUsersController filters with the q, role, provider, verified, suspended,
+// created_after and created_before query parameters
+func (AdCtrl *AdminController) ListUsersController(c *gin.Context) {
+	filter := Domain.UserFilter{
+		Query:    c.Query("q"),
+		Role:     c.Query("role"),
+		Provider: c.Query("provider"),
+	}
+	var err error
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "20")); err != nil || filter.Limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit value"})
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset value"})
+		return
+	}
+	for name, target := range map[string]**bool{"verified": &filter.Verified, "suspended": &filter.Suspended} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " value"})
+				return
+			}
+			*target = &parsed
+		}
+	}
+	for name, target := range map[string]*time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if value := c.Query(name); value != "" {
+			parsed, err := parseDate(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " value, use YYYY-MM-DD or RFC 3339"})
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	users, total, err := AdCtrl.UseCase.ListUsersUC(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := []AdminUserDTO{}
+	for _, user := range users {
+		result = append(result, toAdminUserDTO(user))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": result, "total": total})
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (AdCtrl *AdminController) GetUserController(c *gin.Context) {
+	user, activity, err := AdCtrl.UseCase.GetUserDetailUC(c.Param("id"))
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": toAdminUserDTO(*user), "activity": UserActivityDTO(activity)})
+}
+
+func (AdCtrl *AdminController) SuspendUserController(c *gin.Context) {
+	var body SuspendUserDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor := c.MustGet("user").(*Domain.User)
+	user, err := AdCtrl.UseCase.SuspendUserUC(*actor, c.Param("id"), body.Reason, body.Until)
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	message := "user suspended"
+	if body.Until == nil {
+		message = "user banned"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "user": toAdminUserDTO(*user)})
+}
+
+func (AdCtrl *AdminController) UnsuspendUserController(c *gin.Context) {
+	actor := c.MustGet("user").(*Domain.User)
+	user, err := AdCtrl.UseCase.UnsuspendUserUC(*actor, c.Param("id"))
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "suspension lifted", "user": toAdminUserDTO(*user)})
+}
+
+func (AdCtrl *AdminController) ForceLogoutController(c *gin.Context) {
+	actor := c.MustGet("user").(*Domain.User)
+	revoked, err := AdCtrl.UseCase.ForceLogoutUC(*actor, c.Param("id"))
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user signed out of every session, personal access tokens revoked", "access_tokens_revoked": revoked})
+}
+
+func (AdCtrl *AdminController) TriggerPasswordResetController(c *gin.Context) {
+	actor := c.MustGet("user").(*Domain.User)
+	if err := AdCtrl.UseCase.TriggerPasswordResetUC(*actor, c.Param("id")); err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password reset link sent"})
+}
+
+func adminError(c *gin.Context, err error) {
+	if errors.Is(err, Domain.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	switch err.Error() {
+	case "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "a reason is required", "suspension must end in the future":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case "user is not suspended":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toAdminUserDTO(user Domain.User) AdminUserDTO {
+	dto := AdminUserDTO{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Roles:       user.Roles,
+		Verified:    user.Verfied,
+		Provider:    user.Provider,
+		Linked:      []string{},
+		TOTPEnabled: user.TOTPEnabled,
+	}
+	for _, account := range user.LinkedAccounts {
+		dto.Linked = append(dto.Linked, account.Provider)
+	}
+	if !user.CreatedAt.IsZero() {
+		dto.CreatedAt = &user.CreatedAt
+	}
+	if s := user.Suspension; s != nil {
+		dto.Suspension = &SuspensionDTO{Reason: s.Reason, By: s.By, At: s.At, Until: s.Until, Active: s.ActiveAt(time.Now())}
+	}
+	return dto
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import "time"
+
+type SuspendUserDTO struct {
+	Reason string `json:"reason" binding:"required"`
+	// Left out for a ban
+	Until *time.Time `json:"until"`
+}
+
+type SuspensionDTO struct {
+	Reason string     `json:"reason"`
+	By     string     `json:"by"`
+	At     time.Time  `json:"at"`
+	Until  *time.Time `json:"until"`
+	Active bool       `json:"active"`
+}
+
+type AdminUserDTO struct {
+	ID          string         `json:"id"`
+	Username    string         `json:"username"`
+	Email       string         `json:"email"`
+	Roles       []string       `json:"roles"`
+	Verified    bool           `json:"verified"`
+	Provider    string         `json:"provider"`
+	Linked      []string       `json:"linked_providers"`
+	TOTPEnabled bool           `json:"totp_enabled"`
+	CreatedAt   *time.Time     `json:"created_at"`
+	Suspension  *SuspensionDTO `json:"suspension"`
+}
+
+type UserActivityDTO struct {
+	Blogs          int   `json:"blogs"`
+	PublishedBlogs int   `json:"published_blogs"`
+	TrashedBlogs   int   `json:"trashed_blogs"`
+	ReviewComments int   `json:"review_comments"`
+	Reactions      int   `json:"reactions"`
+	ReadingList    int   `json:"reading_list"`
+	Sessions       int   `json:"sessions"`
+	AccessTokens   int   `json:"access_tokens"`
+	Uploads        int   `json:"uploads"`
+	StorageUsed    int64 `json:"storage_used"`
+}
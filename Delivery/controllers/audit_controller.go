@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	UseCase Domain.AuditUseCaseI
+}
+
+func NewAuditController(uc Domain.AuditUseCaseI) *AuditController {
+	return &AuditController{
+		UseCase: uc,
+	}
+}
+
+// QueryAuditController pages through the audit log, newest first
+func (AuCtrl *AuditController) QueryAuditController(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	var err error
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "50")); err != nil || filter.Limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit value"})
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset value"})
+		return
+	}
+
+	entries, err := AuCtrl.UseCase.QueryAuditUC(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := []AuditEntryDTO{}
+	for _, entry := range entries {
+		result = append(result, toAuditEntryDTO(entry))
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": result})
+}
+
+// ExportAuditController streams every matching entry as newline delimited
+// JSON, oldest first, without holding the whole log in memory
+func (AuCtrl *AuditController) ExportAuditController(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	encoder := json.NewEncoder(c.Writer)
+	err := AuCtrl.UseCase.ExportAuditUC(filter, func(entry Domain.AuditEntry) error {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", `attachment; filename="audit-log.ndjson"`)
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(toAuditEntryDTO(entry)); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	switch {
+	case err != nil && !c.Writer.Written():
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case err != nil:
+		// The status is already sent, the client is left with a cut off file
+		log.Print("audit export failed: ", err)
+	case !c.Writer.Written():
+		// Nothing matched, the export is an empty file
+		c.Data(http.StatusOK, "application/x-ndjson", nil)
+	}
+}
+
+// VerifyAuditController checks that no entry was changed or removed since
+// it was written
+func (AuCtrl *AuditController) VerifyAuditController(c *gin.Context) {
+	result, err := AuCtrl.UseCase.VerifyAuditUC()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"entries": result.Entries, "valid": result.Valid}
+	if !result.Valid {
+		response["broken_at"] = result.BrokenAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// auditFilter reads the actor, action, target_type, target_id, from and to
+// query parameters, answering the request itself when one is invalid
+func auditFilter(c *gin.Context) (Domain.AuditFilter, bool) {
+	filter := Domain.AuditFilter{
+		ActorID:    c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := parseDate(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " value, use YYYY-MM-DD or RFC 3339"})
+				return filter, false
+			}
+			*target = parsed
+		}
+	}
+	return filter, true
+}
+
+func toAuditEntryDTO(entry Domain.AuditEntry) AuditEntryDTO {
+	return AuditEntryDTO{
+		ID:         entry.ID,
+		Seq:        entry.Seq,
+		Time:       entry.Time,
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         entry.IP,
+		UserAgent:  entry.UserAgent,
+		Before:     rawJSON(entry.Before),
+		After:      rawJSON(entry.After),
+		PrevHash:   entry.PrevHash,
+		Hash:       entry.Hash,
+	}
+}
+
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntryDTO struct {
+	ID         string          `json:"id"`
+	Seq        int64           `json:"seq,omitempty"`
+	Time       time.Time       `json:"time"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	PrevHash   string          `json:"prev_hash,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+}
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -25,16 +27,16 @@ func (BlgCtrl *BlogController) CreateBlogController(c *gin.Context) {
 	log.Print("gets here")
 	err := c.ShouldBindJSON(&blog)
 	user, _ := c.Get("user")
-	blog.Owner_email = user.(*Domain.User).Email
+	blog.OwnerID = user.(*Domain.User).ID
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// validate if the user is authorized and authenticated
-	err = BlgCtrl.UseCase.CreateBlogUC(BlgCtrl.ChangeToDomain(blog))
+	err = BlgCtrl.UseCase.CreateBlogUC(BlgCtrl.ChangeToDomain(blog), *user.(*Domain.User))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		BlgCtrl.blogError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"message: ": "blog created successfully"})
@@ -42,8 +44,8 @@ func (BlgCtrl *BlogController) CreateBlogController(c *gin.Context) {
 
 func (BlgCtrl *BlogController) GetLikedController(c *gin.Context) {
 	user := c.MustGet("user")
-	// Get all liked blogs using email
-	blogs, err := BlgCtrl.UseCase.GetLikedUC(user.(*Domain.User).Email)
+	// Get all liked blogs of the user
+	blogs, err := BlgCtrl.UseCase.GetLikedUC(user.(*Domain.User).ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error" : err.Error()})
 		return
@@ -80,23 +82,13 @@ func (BlgCtrl *BlogController) UpdateBlogController(c *gin.Context) {
 	}
 	user := c.MustGet("user").(*Domain.User)
 
-	blog, err := BlgCtrl.UseCase.GetByIdBlogUC(updated_blog.ID)
+	// Call usecase and handle different errors
+	err = BlgCtrl.UseCase.UpdateBlogUC(BlgCtrl.ChangeToDomain(updated_blog), *user)
 	if err != nil {
-		if err.Error() == "Document with id "+updated_blog.ID+" not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if errors.Is(err, Domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if blog.Owner_email != user.Email {
-		c.JSON(http.StatusUnauthorized, gin.H{"error: ": "Only owner can update this blog."})
-		return
-	}
-
-	// Call usecase and handle different errors
-	err = BlgCtrl.UseCase.UpdateBlogUC(BlgCtrl.ChangeToDomain(updated_blog))
-	if err != nil {
 		if err.Error() == "blog not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
@@ -113,13 +105,41 @@ func (BlgCtrl *BlogController) UpdateBlogController(c *gin.Context) {
 
 func (BlgCtrl *BlogController) DeleteBlogController(c *gin.Context) {
 	id := c.Param("id")
+	user := c.MustGet("user").(*Domain.User)
 
-	//validate if the user is owner or admin
-	if err := BlgCtrl.UseCase.DeleteBlogUC(id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := BlgCtrl.UseCase.DeleteBlogUC(id, *user); err != nil {
+		BlgCtrl.blogError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message: ": " blog deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message: ": " blog moved to trash"})
+}
+
+func (BlgCtrl *BlogController) TrashController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	blogs, err := BlgCtrl.UseCase.GetTrashUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"trash": blogs})
+}
+
+func (BlgCtrl *BlogController) RestoreBlogController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.RestoreBlogUC(c.Param("id"), *user); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "blog restored"})
+}
+
+func (BlgCtrl *BlogController) PurgeBlogController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.PurgeBlogUC(c.Param("id"), *user); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "blog permanently deleted"})
 }
 
 func (BlgCtrl *BlogController) GetAllBlogController(c *gin.Context) {
@@ -177,6 +197,17 @@ func (BlgCtrl *BlogController) GetBlogController(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"Blog: ": blog})
 }
 
+// PreviewBlogController shows drafts and blogs in review to their authors and reviewers
+func (BlgCtrl *BlogController) PreviewBlogController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	blog, err := BlgCtrl.UseCase.PreviewBlogUC(c.Param("id"), *user)
+	if err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Blog: ": blog})
+}
+
 func (BlgCtrl *BlogController) LikeBlogController(c *gin.Context) {
 	id := c.Param("id")
 	_, err := BlgCtrl.UseCase.GetByIdBlogUC(id)
@@ -187,9 +218,9 @@ func (BlgCtrl *BlogController) LikeBlogController(c *gin.Context) {
 
 	// check if the user have liked the post previously
 	user, _ := c.Get("user")
-	liked, err := BlgCtrl.UseCase.CheckIfLiked(user.(*Domain.User).Email, id)
+	liked, err := BlgCtrl.UseCase.CheckIfLiked(user.(*Domain.User).ID, id)
 	if err != nil {
-		if err.Error() == "invalid blog id or user email when checking liked" {
+		if err.Error() == "invalid blog id or user id when checking liked" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -198,7 +229,7 @@ func (BlgCtrl *BlogController) LikeBlogController(c *gin.Context) {
 	}
 	var Liketrk Domain.LikeTracker
 	Liketrk.BlogID = id
-	Liketrk.UserEmail = user.(*Domain.User).Email
+	Liketrk.UserID = user.(*Domain.User).ID
 
 	if liked == 1 {
 		Liketrk.Liked = 0
@@ -220,7 +251,7 @@ func (BlgCtrl *BlogController) LikeBlogController(c *gin.Context) {
 func (BlgCtrl *BlogController) DisLikeBlogController(c *gin.Context) {
 	id := c.Param("id")
 	user, _ := c.Get("user")
-	user_email := user.(*Domain.User).Email
+	userID := user.(*Domain.User).ID
 	_, err := BlgCtrl.UseCase.GetByIdBlogUC(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
@@ -229,10 +260,10 @@ func (BlgCtrl *BlogController) DisLikeBlogController(c *gin.Context) {
 	// Check if user has already disliked this post
 	var Liketrk Domain.LikeTracker
 	Liketrk.BlogID = id
-	Liketrk.UserEmail = user_email
-	liked, err := BlgCtrl.UseCase.CheckIfLiked(user_email, id)
+	Liketrk.UserID = userID
+	liked, err := BlgCtrl.UseCase.CheckIfLiked(userID, id)
 	if err != nil {
-		if err.Error() == "invalid blog id or user email when checking liked" {
+		if err.Error() == "invalid blog id or user id when checking liked" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -289,15 +320,12 @@ func (BlgCtrl *BlogController) DislikesController(c *gin.Context) {
 
 func (BlgCtrl *BlogController) ViewBlogController(c *gin.Context) {
 	id := c.Param("id")
-	blog, err := BlgCtrl.UseCase.GetByIdBlogUC(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
-		return
-	}
-	// check if the user have viewed the post previously
-	blog.ViewCount += 1
-	err = BlgCtrl.UseCase.UpdateBlogUC(blog)
+	err := BlgCtrl.UseCase.ViewBlogUC(id)
 	if err != nil {
+		if err.Error() == "blog not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -312,14 +340,21 @@ func (BlgCtrl *BlogController) CommentsBlogController(c *gin.Context) {
 		return
 	}
 	id := c.Param("id")
-	blog, err := BlgCtrl.UseCase.GetByIdBlogUC(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
-		return
-	}
-	blog.Comments = append(blog.Comments, comment)
-	err = BlgCtrl.UseCase.UpdateBlogUC(blog)
+	user := c.MustGet("user").(*Domain.User)
+	err = BlgCtrl.UseCase.AddCommentUC(id, *user, comment)
 	if err != nil {
+		if errors.Is(err, Domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "blog not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "comment can not be empty" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -355,24 +390,110 @@ func (BlgCtrl *BlogController) GetPopularBlogs(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"blogs: ": blogs})
 }
 
+func (BlgCtrl *BlogController) SubmitForReviewController(c *gin.Context) {
+	id := c.Param("id")
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.SubmitForReviewUC(id, *user); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "blog submitted for review"})
+}
+
+func (BlgCtrl *BlogController) ReviewBlogController(c *gin.Context) {
+	var review ReviewDTO
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id := c.Param("id")
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.ReviewBlogUC(id, *user, review.Decision, review.Comment); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "review recorded"})
+}
+
+func (BlgCtrl *BlogController) PublishBlogController(c *gin.Context) {
+	id := c.Param("id")
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.PublishBlogUC(id, *user); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "blog published"})
+}
+
+func (BlgCtrl *BlogController) ReviewQueueController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	blogs, err := BlgCtrl.UseCase.GetReviewQueueUC(*user)
+	if err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"queue": blogs})
+}
+
+func (BlgCtrl *BlogController) ReviewHistoryController(c *gin.Context) {
+	id := c.Param("id")
+	user := c.MustGet("user").(*Domain.User)
+	transitions, comments, err := BlgCtrl.UseCase.GetReviewHistoryUC(id, *user)
+	if err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transitions": transitions, "comments": comments})
+}
+
+func (BlgCtrl *BlogController) SetCoAuthorsController(c *gin.Context) {
+	var body CoAuthorsDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	if err := BlgCtrl.UseCase.SetCoAuthorsUC(c.Param("id"), *user, body.CoAuthors); err != nil {
+		BlgCtrl.blogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "co-authors updated"})
+}
+
+// map review and ownership errors to status codes
+func (BlgCtrl *BlogController) blogError(c *gin.Context, err error) {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, Domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+	case msg == "blog not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	case strings.HasPrefix(msg, "invalid status transition"):
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	case msg == "invalid review decision" || msg == "a comment is required when requesting changes" || msg == "invalid co-author email":
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
+
 // method to convert from Blog DTO to Blog structure
 func (BlgCtrl *BlogController) ChangeToDomain(BlgDto BlogDTO) Domain.Blog {
 	blog := Domain.Blog{
 		ID:          BlgDto.ID,
 		Date:        BlgDto.Date,
 		Title:       BlgDto.Title,
-		Owner_email: BlgDto.Owner_email,
+		OwnerID:     BlgDto.OwnerID,
 		Content:     BlgDto.Content,
 		Tags:        BlgDto.Tags,
 		ViewCount:   BlgDto.ViewCount,
-		Comments:    BlgDto.Comments,
 	}
 	return blog
 }
 
 func (BlgCtrl *BlogController) ReadLatersBlogController(c *gin.Context) {
 	user := c.MustGet("user").(*Domain.User)
-	blogs, err := BlgCtrl.UseCase.FetchFromReadLater(user.Email)
+	blogs, err := BlgCtrl.UseCase.FetchFromReadLater(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error: ": err.Error()})
 		return
@@ -383,7 +504,7 @@ func (BlgCtrl *BlogController) ReadLatersBlogController(c *gin.Context) {
 func (BlgCtrl *BlogController) InsertReadLatersBlogController(c *gin.Context) {
 	id := c.Param("id")
 	user := c.MustGet("user").(*Domain.User)
-	err := BlgCtrl.UseCase.AddToReadLater(user.Email, id)
+	err := BlgCtrl.UseCase.AddToReadLater(user.ID, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error: ": err.Error()})
 		return
@@ -7,9 +7,17 @@ type BlogDTO struct {
 	ID        string  
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
-	Owner_email string      `json:"owner"`
+	OwnerID   string    `json:"owner"`
 	Tags      []string  `json:"tags"`
 	Date      time.Time `json:"date"`
 	ViewCount int       `json:"viewCount"`
-	Comments  []string  `json:"comments"`
-}
\ No newline at end of file
+}
+
+type ReviewDTO struct {
+	Decision string `json:"decision" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+type CoAuthorsDTO struct {
+	CoAuthors []string `json:"coauthors"`
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailChangeController struct {
+	UseCase Domain.EmailChangeUseCaseI
+}
+
+func NewEmailChangeController(uc Domain.EmailChangeUseCaseI) *EmailChangeController {
+	return &EmailChangeController{
+		UseCase: uc,
+	}
+}
+
+func (EcCtrl *EmailChangeController) RequestEmailChangeController(c *gin.Context) {
+	var body ChangeEmailDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	if err := EcCtrl.UseCase.RequestEmailChangeUC(*user, c.GetString("session_id"), body.NewEmail, body.Password); err != nil {
+		switch err.Error() {
+		case "invalid email", "new email is the same as the current one":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case "invalid password", "sign in again to change your email":
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case "email already exists in database":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "confirmation links sent to your current and your new address"})
+}
+
+// CheckEmailChangeController is what the emailed links open. It shows the
+// pending change, confirming it takes a POST.
+func (EcCtrl *EmailChangeController) CheckEmailChangeController(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	change, err := EcCtrl.UseCase.CheckEmailChangeUC(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"new_email": change.NewEmail, "expires_at": change.ExpiresAt, "message": "POST the token to /user/email/confirm to confirm"})
+}
+
+func (EcCtrl *EmailChangeController) ConfirmEmailChangeController(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	_ = c.ShouldBindJSON(&body)
+	token := body.Token
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	change, err := EcCtrl.UseCase.ConfirmEmailChangeUC(token)
+	if err != nil {
+		switch err.Error() {
+		case "invalid or expired link":
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case "email already exists in database":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if !change.OldConfirmed || !change.NewConfirmed {
+		c.JSON(http.StatusAccepted, gin.H{"message": "address confirmed, open the link sent to the other address to finish the change"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email changed, sign in again with " + change.NewEmail})
+}
+
+func (EcCtrl *EmailChangeController) CancelEmailChangeController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := EcCtrl.UseCase.CancelEmailChangeUC(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email change cancelled"})
+}
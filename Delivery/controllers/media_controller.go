@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Room for the multipart boundaries, part headers and other small fields
+const multipartOverhead = 1 << 20
+
+type MediaController struct {
+	UseCase Domain.MediaUseCaseI
+	// maxSize is the largest file accepted, the request body may only be a
+	// little larger than that
+	maxSize int64
+}
+
+func NewMediaController(uc Domain.MediaUseCaseI, maxSize int64) *MediaController {
+	return &MediaController{
+		UseCase: uc,
+		maxSize: maxSize,
+	}
+}
+
+func (MdCtrl *MediaController) UploadMediaController(c *gin.Context) {
+	// Cut the body off before parsing, which would otherwise spool all of it
+	// to memory and temp files before the size is ever checked
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MdCtrl.maxSize+multipartOverhead)
+	fileHeader, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart field 'file' is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	user := c.MustGet("user").(*Domain.User)
+	media, err := MdCtrl.UseCase.UploadMediaUC(user.ID, fileHeader.Filename, fileHeader.Size, file)
+	if err != nil {
+		switch err.Error() {
+		case "empty file", "unsupported file type", "invalid image":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case "file too large", "image dimensions too large":
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case "storage quota exceeded":
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"media": media})
+}
+
+func (MdCtrl *MediaController) GetMediaController(c *gin.Context) {
+	media, data, err := MdCtrl.UseCase.GetMediaUC(c.Param("id"))
+	if err != nil {
+		if err.Error() == "media not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Uploads never change once stored so their URL can be cached forever
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, media.ContentType, data)
+}
+
+func (MdCtrl *MediaController) ListMediaController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	media, err := MdCtrl.UseCase.ListMediaUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"media": media})
+}
+
+func (MdCtrl *MediaController) DeleteMediaController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	err := MdCtrl.UseCase.DeleteMediaUC(c.Param("id"), *user)
+	if err != nil {
+		if errors.Is(err, Domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		switch err.Error() {
+		case "media not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "file deleted"})
+}
+
+func (MdCtrl *MediaController) GetMediaVariantController(c *gin.Context) {
+	variant, data, err := MdCtrl.UseCase.GetMediaVariantUC(c.Param("id"), c.Param("variant"))
+	if err != nil {
+		if err.Error() == "media not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, variant.ContentType, data)
+}
+
+func (MdCtrl *MediaController) SetBlogCoverController(c *gin.Context) {
+	var body ImageSelectDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	cover, err := MdCtrl.UseCase.SetBlogCoverUC(c.Param("id"), body.MediaID, *user)
+	if err != nil {
+		MdCtrl.imageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "cover image updated", "cover": cover})
+}
+
+func (MdCtrl *MediaController) SetAvatarController(c *gin.Context) {
+	var body ImageSelectDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	avatar, err := MdCtrl.UseCase.SetAvatarUC(body.MediaID, *user)
+	if err != nil {
+		MdCtrl.imageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "avatar updated", "avatar": avatar})
+}
+
+func (MdCtrl *MediaController) imageError(c *gin.Context, err error) {
+	if errors.Is(err, Domain.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	switch err.Error() {
+	case "blog not found", "media not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "media is not an image":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
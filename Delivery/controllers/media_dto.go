@@ -0,0 +1,6 @@
+package controllers
+
+// An empty media id removes the current image
+type ImageSelectDTO struct {
+	MediaID string `json:"media_id"`
+}
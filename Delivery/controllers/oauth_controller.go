@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthController struct {
+	UseCase Domain.OAuthUseCaseI
+}
+
+func NewOAuthController(uc Domain.OAuthUseCaseI) *OAuthController {
+	return &OAuthController{
+		UseCase: uc,
+	}
+}
+
+func (OaCtrl *OAuthController) RegisterClientController(c *gin.Context) {
+	var body OAuthClientDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	client, secret, err := OaCtrl.UseCase.RegisterClientUC(user.ID, Domain.OAuthClient{
+		Name:         body.Name,
+		RedirectURIs: body.RedirectURIs,
+		Scopes:       body.Scopes,
+		Public:       body.Public,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"client": toOAuthClientDTO(client)}
+	if secret != "" {
+		response["client_secret"] = secret
+		response["message"] = "copy the client secret now, it will not be shown again"
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+func (OaCtrl *OAuthController) ListClientsController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	clients, err := OaCtrl.UseCase.ListClientsUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := []OAuthClientResponseDTO{}
+	for _, client := range clients {
+		result = append(result, toOAuthClientDTO(client))
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": result})
+}
+
+func (OaCtrl *OAuthController) DeleteClientController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := OaCtrl.UseCase.DeleteClientUC(user.ID, c.Param("id")); err != nil {
+		if err.Error() == "client not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "client deleted"})
+}
+
+// ConsentController describes what the app asks for, the user's answer is
+// posted back to the same path
+func (OaCtrl *OAuthController) ConsentController(c *gin.Context) {
+	var body AuthorizeDTO
+	if err := c.ShouldBindQuery(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	client, scopes, err := OaCtrl.UseCase.ConsentUC(toAuthorizeRequest(body))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	requested := []ScopeDTO{}
+	for _, scope := range scopes {
+		requested = append(requested, ScopeDTO{Name: scope, Description: Domain.ScopeDescriptions[scope]})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"client":  gin.H{"client_id": client.ID, "name": client.Name},
+		"scopes":  requested,
+		"request": body,
+		"message": "post this request back to /oauth/authorize with approve set to true or false",
+	})
+}
+
+func (OaCtrl *OAuthController) AuthorizeController(c *gin.Context) {
+	var body AuthorizeDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	redirect, err := OaCtrl.UseCase.AuthorizeUC(*user, toAuthorizeRequest(body), body.Approve)
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirect})
+}
+
+// TokenController takes form encoded parameters as RFC 6749 requires
+func (OaCtrl *OAuthController) TokenController(c *gin.Context) {
+	clientID, clientSecret := clientCredentials(c)
+	tokens, err := OaCtrl.UseCase.TokenUC(Domain.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}, deviceInfo(c))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	expiresIn, _ := strconv.Atoi(tokens["expires_in"])
+	response := gin.H{
+		"access_token":  tokens["access_token"],
+		"refresh_token": tokens["refresh_token"],
+		"token_type":    "Bearer",
+		"expires_in":    expiresIn,
+	}
+	if scope := tokens["scope"]; scope != "" {
+		response["scope"] = scope
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+func (OaCtrl *OAuthController) RevokeController(c *gin.Context) {
+	clientID, clientSecret := clientCredentials(c)
+	if err := OaCtrl.UseCase.RevokeUC(clientID, clientSecret, c.PostForm("token")); err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (OaCtrl *OAuthController) IntrospectController(c *gin.Context) {
+	clientID, clientSecret := clientCredentials(c)
+	info, err := OaCtrl.UseCase.IntrospectUC(clientID, clientSecret, c.PostForm("token"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	if !info.Active {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"scope":      info.Scope,
+		"client_id":  info.ClientID,
+		"sub":        info.Subject,
+		"username":   info.Username,
+		"token_type": info.TokenType,
+		"exp":        info.Exp,
+	})
+}
+
+// clientCredentials reads HTTP basic auth, falling back to the form body
+func clientCredentials(c *gin.Context) (string, string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		return id, secret
+	}
+	return c.PostForm("client_id"), c.PostForm("client_secret")
+}
+
+func oauthError(c *gin.Context, err error) {
+	var oerr *Domain.OAuthError
+	if !errors.As(err, &oerr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+	status := http.StatusBadRequest
+	if oerr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	c.JSON(status, gin.H{"error": oerr.Code, "error_description": oerr.Description})
+}
+
+func toAuthorizeRequest(body AuthorizeDTO) Domain.AuthorizeRequest {
+	return Domain.AuthorizeRequest{
+		ResponseType:        body.ResponseType,
+		ClientID:            body.ClientID,
+		RedirectURI:         body.RedirectURI,
+		Scope:               strings.TrimSpace(body.Scope),
+		State:               body.State,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+	}
+}
+
+func toOAuthClientDTO(client Domain.OAuthClient) OAuthClientResponseDTO {
+	return OAuthClientResponseDTO{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		Public:       client.Public,
+		CreatedAt:    client.CreatedAt,
+	}
+}
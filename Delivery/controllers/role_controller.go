@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	UseCase Domain.RoleUseCaseI
+}
+
+func NewRoleController(uc Domain.RoleUseCaseI) *RoleController {
+	return &RoleController{
+		UseCase: uc,
+	}
+}
+
+func (RlCtrl *RoleController) ListRolesController(c *gin.Context) {
+	roles, err := RlCtrl.UseCase.ListRolesUC()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": Domain.Permissions})
+}
+
+func (RlCtrl *RoleController) SaveRoleController(c *gin.Context) {
+	var body RoleDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor := c.MustGet("user").(*Domain.User)
+	role := Domain.Role{Name: c.Param("name"), Description: body.Description, Permissions: body.Permissions}
+	if err := RlCtrl.UseCase.SaveRoleUC(*actor, role); err != nil {
+		RlCtrl.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "role saved", "role": role})
+}
+
+func (RlCtrl *RoleController) DeleteRoleController(c *gin.Context) {
+	actor := c.MustGet("user").(*Domain.User)
+	if err := RlCtrl.UseCase.DeleteRoleUC(*actor, c.Param("name")); err != nil {
+		RlCtrl.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
+
+func (RlCtrl *RoleController) AssignRolesController(c *gin.Context) {
+	var body AssignRolesDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor := c.MustGet("user").(*Domain.User)
+	user, err := RlCtrl.UseCase.AssignRolesUC(*actor, body.Email, body.Roles)
+	if err != nil {
+		RlCtrl.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "roles updated",
+		"user": gin.H{
+			"email": user.Email,
+			"roles": user.Roles,
+		},
+	})
+}
+
+func (RlCtrl *RoleController) roleError(c *gin.Context, err error) {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, Domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+	case msg == "role not found" || msg == "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	case msg == "role is still assigned to users" || msg == "built-in roles can not be deleted":
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	case msg == "invalid role name" || msg == "invalid role" || msg == "at least one role is required" || strings.HasPrefix(msg, "unknown permission"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
@@ -0,0 +1,11 @@
+package controllers
+
+type RoleDTO struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRolesDTO struct {
+	Email string   `json:"email" binding:"required"`
+	Roles []string `json:"roles" binding:"required"`
+}
@@ -2,13 +2,25 @@ package controllers
 
 import (
 	"blog_api/Domain"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/markbates/goth/gothic"
 )
 
+const (
+	// linkTokenCookie carries a link token from LinkProviderController to the provider login
+	linkTokenCookie = "link_token"
+	// linkTokenPath limits the cookie to the provider login routes
+	linkTokenPath = "/user/auth"
+	// linkTokenTTL matches how long the link token itself works
+	linkTokenTTL = 5 * time.Minute
+)
+
 type UserController struct {
 	usecase Domain.UserUsecaseI
 }
@@ -25,13 +37,11 @@ func (UsrCtrl *UserController) ResetPasswordController(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	data.Created_at = time.Now()
-	err := UsrCtrl.usecase.ResetPasswordUsecase(*UsrCtrl.ChangeToDomainToken(data))
+	err := UsrCtrl.usecase.ResetPasswordUsecase(data.Token, data.NewPassword, deviceInfo(c))
+	if passwordRejected(c, err) {
+		return
+	}
 	if err != nil {
-		if err.Error() == "invalid email" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
 		if err.Error() == "user not found" {
 			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 			return
@@ -47,7 +57,7 @@ func (UsrCtrl *UserController) ResetPasswordController(c *gin.Context) {
 }
 
 func (UsrCtrl *UserController) ForgotPasswordController(c *gin.Context) {
-	var tmp ResetTokenSDTO
+	var tmp ForgotPasswordDTO
 
 	if c.ShouldBindJSON(&tmp) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "error while binding JSON"})
@@ -68,7 +78,7 @@ func (UsrCtrl *UserController) ForgotPasswordController(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "an email with a reset toke has been sent", "redirect": "/reset-password"})
+	c.JSON(http.StatusOK, gin.H{"message": "an email with a reset link has been sent"})
 }
 
 func (UsrCtrl *UserController) SignInWithProvider(c *gin.Context) {
@@ -77,6 +87,23 @@ func (UsrCtrl *UserController) SignInWithProvider(c *gin.Context) {
 	q.Add("provider", provider)
 	c.Request.URL.RawQuery = q.Encode()
 
+	// A link token marks this round trip as linking a provider to a signed in account.
+	// It only comes from the cookie set for this browser, a link sent by someone
+	// else can't attach their account to the provider login done here. Storing
+	// it even when empty clears one left behind by an abandoned attempt.
+	linkToken := ""
+	if c.Query("link") != "" {
+		linkToken, _ = c.Cookie(linkTokenCookie)
+		if linkToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired link token"})
+			return
+		}
+		c.SetCookie(linkTokenCookie, "", -1, linkTokenPath, "", c.Request.TLS != nil, true)
+	}
+	if err := gothic.StoreInSession("link_token", linkToken, c.Request, c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	gothic.BeginAuthHandler(c.Writer, c.Request)
 }
 
@@ -86,6 +113,8 @@ func (UsrCtrl *UserController) OauthCallback(c *gin.Context) {
 	q.Add("provider", provider)
 	c.Request.URL.RawQuery = q.Encode()
 
+	// Read before completing, which clears the gothic session
+	linkToken, _ := gothic.GetFromSession("link_token", c.Request)
 	user, err := gothic.CompleteUserAuth(c.Writer, c.Request)
 
 	if err != nil {
@@ -93,11 +122,35 @@ func (UsrCtrl *UserController) OauthCallback(c *gin.Context) {
 		return
 	}
 
-	token, err := UsrCtrl.usecase.OauthCallbackUsecase(&user)
+	if linkToken != "" {
+		if err := UsrCtrl.usecase.LinkProviderUC(linkToken, &user); err != nil {
+			linkError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": provider + " account linked"})
+		return
+	}
+
+	token, err := UsrCtrl.usecase.OauthCallbackUsecase(&user, deviceInfo(c))
+	if accountSuspended(c, err) {
+		return
+	}
 	if err != nil {
+		if err.Error() == "an account with this email already exists, sign in and link the provider from your account" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "provider did not share an email address" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if token["mfa_token"] != "" {
+		mfaRequired(c, token)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "logged in successfully", "access token": token["access_token"], "refresh token" : token["refresh_token"]})
 }
 
@@ -108,7 +161,13 @@ func (UsrCtrl *UserController) LoginController(c *gin.Context) {
 		return
 	}
 
-	token, err := UsrCtrl.usecase.LoginUsecase(UsrCtrl.ChangeToDomain(user))
+	token, err := UsrCtrl.usecase.LoginUsecase(UsrCtrl.ChangeToDomain(user), deviceInfo(c))
+	if loginThrottled(c, err) {
+		return
+	}
+	if accountSuspended(c, err) {
+		return
+	}
 	if err != nil {
 		if err.Error() == "invalid password or email" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -118,12 +177,25 @@ func (UsrCtrl *UserController) LoginController(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"message": "user not found"})
 			return
 		}
+		if err.Error() == "email not verified" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "redirect": "/user/verify-otp"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if token["mfa_token"] != "" {
+		mfaRequired(c, token)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"tokens": token})
 }
 
+// mfaRequired answers a correct password on an account with two factor enabled
+func mfaRequired(c *gin.Context, token map[string]string) {
+	c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": token["mfa_token"], "next": "/user/login/2fa"})
+}
+
 func (UsrCtrl *UserController) RegisterController(c *gin.Context) {
 	var user UserDTO
 	err := c.ShouldBind(&user)
@@ -136,6 +208,9 @@ func (UsrCtrl *UserController) RegisterController(c *gin.Context) {
 	err = UsrCtrl.usecase.RegisterUsecase(UsrCtrl.ChangeToDomain(user))
 
 	// Handle invalid requests
+	if passwordRejected(c, err) {
+		return
+	}
 	if err != nil && (err.Error() == "invalid email" || err.Error() == "email already exists in database") {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -152,30 +227,116 @@ func (UsrCtrl *UserController) RegisterController(c *gin.Context) {
 }
 
 func (UsrCtrl *UserController) VerifyOTPController(c *gin.Context) {
-	var user UserDTO
-
-	err := c.ShouldBindJSON(&user)
-	if err != nil {
+	var body VerifyOTPDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user format"})
 		return
 	}
 
-	user.OTPTime = time.Now()
-	err = UsrCtrl.usecase.VerifyOTPUsecase(UsrCtrl.ChangeToDomain(user))
+	if err := UsrCtrl.usecase.VerifyOTPUsecase(body.Email, body.OTP); err != nil {
+		otpError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "user registered successfully."})
+}
 
-	if err != nil && err.Error() == "expired otp code" {
-		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+func (UsrCtrl *UserController) ResendOTPController(c *gin.Context) {
+	var body ResendOTPDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err != nil && err.Error() == "user not found" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "no user with such email"})
+	if err := UsrCtrl.usecase.ResendOTPUsecase(body.Email); err != nil {
+		otpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent to your email", "redirect": "/user/verify-otp"})
+}
+
+// ChangePasswordController needs the current password, other devices are signed out
+func (UsrCtrl *UserController) ChangePasswordController(c *gin.Context) {
+	var body ChangePasswordDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	err := UsrCtrl.usecase.ChangePasswordUC(*user, c.GetString("session_id"), body.CurrentPassword, body.NewPassword)
+	if loginThrottled(c, err) || passwordRejected(c, err) {
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch err.Error() {
+		case "invalid current password":
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case "account has no password, use forgot password to set one":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "user registered successfully."})
+	c.JSON(http.StatusOK, gin.H{"message": "password changed, other sessions were signed out"})
+}
+
+// loginThrottled answers 429 with Retry-After when err is a login throttle error
+func loginThrottled(c *gin.Context, err error) bool {
+	var throttled *Domain.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	return true
+}
+
+// passwordRejected answers 400 with every broken rule when err is a password policy error
+func passwordRejected(c *gin.Context, err error) bool {
+	var policyErr *Domain.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	violations := []PasswordViolationDTO{}
+	for _, v := range policyErr.Violations {
+		violations = append(violations, PasswordViolationDTO{Rule: v.Rule, Message: v.Message})
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "violations": violations})
+	return true
+}
+
+// accountSuspended answers 403 with the reason when err is a suspension
+func accountSuspended(c *gin.Context, err error) bool {
+	var suspended *Domain.SuspendedError
+	if !errors.As(err, &suspended) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": suspended.Reason, "until": suspended.Until})
+	return true
+}
+
+func otpError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "no user with such email"})
+	case "expired otp code":
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case "invalid otp code":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case "email already verified":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case "too many attempts, try again later", "please wait before requesting another code":
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// describe the client making the request
+func deviceInfo(c *gin.Context) Domain.DeviceInfo {
+	return Domain.DeviceInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
 }
 
 func (UsrCtrl *UserController) ChangeToDomain(user UserDTO) *Domain.User {
@@ -185,24 +346,11 @@ func (UsrCtrl *UserController) ChangeToDomain(user UserDTO) *Domain.User {
 		Username: user.Username,
 		Bio:      user.Bio,
 		Role:     user.Role,
-		Verfied:  user.Verfied,
-		OTP:      user.OTP,
-		OTPTime:  user.OTPTime,
 		Provider: user.Provider,
 	}
 	return &dom_user
 }
 
-func (UsrCtrl *UserController) ChangeToDomainToken(data ResetTokenSDTO) *Domain.ResetTokenS {
-	var dom_res = Domain.ResetTokenS{
-		Email:       data.Email,
-		NewPassword: data.NewPassword,
-		Token:       data.Token,
-		Created_at:  data.Created_at,
-	}
-	return &dom_res
-}
-
 func (UsrCtrl *UserController) UpdateProfileController(c *gin.Context) {
 	var updateDTO UpdateProfileDTO
 
@@ -226,17 +374,20 @@ func (UsrCtrl *UserController) UpdateProfileController(c *gin.Context) {
 		return
 	}
 
-	// Update fields (only if provided)
-	if updateDTO.Username != "" {
-		currentUser.Username = updateDTO.Username
-	}
-	if updateDTO.Bio != "" {
-		currentUser.Bio = updateDTO.Bio
-	}
+	// Fields left out keep their value
+	update := Domain.User{ID: currentUser.ID, Username: updateDTO.Username, Bio: updateDTO.Bio}
 
 	// Call usecase to update user profile
-	updatedUser, err := UsrCtrl.usecase.UpdateProfileUsecase(currentUser)
+	updatedUser, err := UsrCtrl.usecase.UpdateProfileUsecase(*currentUser, update)
 	if err != nil {
+		if errors.Is(err, Domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -258,8 +409,21 @@ func (UsrCtrl *UserController) UpdateUserRoleController(c *gin.Context) {
 	}
 
 	// Call usecase
-	updatedUser, err := UsrCtrl.usecase.UpdateUserRole(roleDTO.Email, roleDTO.Role)
+	actor := c.MustGet("user").(*Domain.User)
+	updatedUser, err := UsrCtrl.usecase.UpdateUserRole(*actor, roleDTO.Email, roleDTO.Role)
 	if err != nil {
+		if errors.Is(err, Domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "invalid role" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -285,7 +449,10 @@ func (UsrCtrl *UserController) RefreshController(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
 		return
 	}
-	tokens, err := UsrCtrl.usecase.RefreshUseCase(refreshToken.Token)
+	tokens, err := UsrCtrl.usecase.RefreshUseCase(refreshToken.Token, deviceInfo(c))
+	if accountSuspended(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(400, gin.H{"error: ": err.Error()})
 		return
@@ -294,16 +461,280 @@ func (UsrCtrl *UserController) RefreshController(c *gin.Context) {
 }
 
 func (UsrCtrl *UserController) LogoutController(c *gin.Context) {
-	var user UserDTO
 	accessToken := c.MustGet("access_token").(string)
-	err := c.ShouldBindJSON(&user)
-	if err != nil {
+	user := c.MustGet("user").(*Domain.User)
+	if err := UsrCtrl.usecase.LogoutUseCase(*user, c.GetString("session_id"), accessToken); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
 		return
 	}
-	if err = UsrCtrl.usecase.LogoutUseCase(user.Email, accessToken); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error ": err.Error()})
+	c.JSON(200, gin.H{"message: ": "User logout successfully"})
+}
+
+func (UsrCtrl *UserController) ListSessionsController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	sessions, err := UsrCtrl.usecase.ListSessionsUC(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"message: ": "User logout successfully"})
+	current := c.GetString("session_id")
+	result := []SessionDTO{}
+	for _, session := range sessions {
+		result = append(result, SessionDTO{
+			ID:         session.ID,
+			ClientID:   session.ClientID,
+			Scopes:     session.Scopes,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+func (UsrCtrl *UserController) RevokeSessionController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := UsrCtrl.usecase.RevokeSessionUC(user.ID, c.Param("id")); err != nil {
+		if err.Error() == "session not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+func (UsrCtrl *UserController) RevokeOtherSessionsController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	current := c.GetString("session_id")
+	if current == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "current session unknown, please login again"})
+		return
+	}
+	if err := UsrCtrl.usecase.RevokeOtherSessionsUC(user.ID, current); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "signed out of all other sessions"})
+}
+
+// JwksController publishes the public keys our tokens can be verified with
+func (UsrCtrl *UserController) JwksController(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": UsrCtrl.usecase.PublicKeysUC()})
+}
+
+func (UsrCtrl *UserController) EnrollTOTPController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	secret, uri, err := UsrCtrl.usecase.EnrollTOTPUC(user.Email)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri, "message": "add the key to your authenticator app, then confirm with a code"})
+}
+
+func (UsrCtrl *UserController) ConfirmTOTPController(c *gin.Context) {
+	var body TOTPCodeDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	codes, err := UsrCtrl.usecase.ConfirmTOTPUC(*user, body.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "two factor authentication enabled", "recovery_codes": codes})
+}
+
+func (UsrCtrl *UserController) DisableTOTPController(c *gin.Context) {
+	var body TOTPCodeDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*Domain.User)
+	if err := UsrCtrl.usecase.DisableTOTPUC(*user, body.Code); err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "two factor authentication disabled"})
+}
+
+func (UsrCtrl *UserController) CompleteMFALoginController(c *gin.Context) {
+	var body MFALoginDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := UsrCtrl.usecase.CompleteMFALoginUC(body.MFAToken, body.Code, deviceInfo(c))
+	if accountSuspended(c, err) {
+		return
+	}
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": token})
+}
+
+func mfaError(c *gin.Context, err error) {
+	msg := err.Error()
+	switch msg {
+	case "invalid mfa token", "invalid two factor code":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+	case "too many attempts, try again later":
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": msg})
+	case "two factor authentication already enabled":
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	case "two factor authentication not enabled", "no two factor enrollment pending":
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	case "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
+
+func (UsrCtrl *UserController) RequestMagicLinkController(c *gin.Context) {
+	var body MagicLinkDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := UsrCtrl.usecase.RequestMagicLinkUC(body.Email); err != nil {
+		if err.Error() == "invalid email" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "if an account exists for this address, a sign in link has been sent"})
+}
+
+// CheckMagicLinkController is what the emailed link opens. It only tells
+// whether the token still works, signing in takes a POST.
+func (UsrCtrl *UserController) CheckMagicLinkController(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	expiresAt, err := UsrCtrl.usecase.CheckMagicLinkUC(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true, "expires_at": expiresAt, "message": "POST the token to /user/magic-link to sign in"})
+}
+
+// MagicLinkLoginController takes the token from a JSON body and signs in
+func (UsrCtrl *UserController) MagicLinkLoginController(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	_ = c.ShouldBindJSON(&body)
+	token := body.Token
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	tokens, err := UsrCtrl.usecase.MagicLinkLoginUC(token, deviceInfo(c))
+	if accountSuspended(c, err) {
+		return
+	}
+	if err != nil {
+		if err.Error() == "invalid or expired link" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tokens["mfa_token"] != "" {
+		mfaRequired(c, tokens)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// MeController returns the signed in user's profile
+func (UsrCtrl *UserController) MeController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	c.JSON(http.StatusOK, gin.H{"user": gin.H{
+		"id":              user.ID,
+		"username":        user.Username,
+		"email":           user.Email,
+		"bio":             user.Bio,
+		"roles":           user.Roles,
+		"verified":        user.Verfied,
+		"avatar":          user.Avatar,
+		"linked_accounts": linkedAccounts(user.LinkedAccounts),
+	}})
+}
+
+// LinkProviderController hands out the address that starts linking a provider.
+// The link token goes into a cookie instead of the address, so only the
+// browser that asked can use it. The provider's callback finishes the link.
+func (UsrCtrl *UserController) LinkProviderController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	provider := c.Param("provider")
+	linkToken, err := UsrCtrl.usecase.CreateLinkTokenUC(user.Email, provider)
+	if err != nil {
+		linkError(c, err)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(linkTokenCookie, linkToken, int(linkTokenTTL.Seconds()), linkTokenPath, "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"url": "/user/auth/" + provider + "?link=1"})
+}
+
+func (UsrCtrl *UserController) UnlinkProviderController(c *gin.Context) {
+	user := c.MustGet("user").(*Domain.User)
+	if err := UsrCtrl.usecase.UnlinkProviderUC(user.Email, c.Param("provider")); err != nil {
+		linkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "provider unlinked"})
+}
+
+func linkError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "unknown provider", "provider not linked":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "provider already linked", "this provider account is already linked to another user", "set a password before unlinking your last sign in method":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case "invalid or expired link token":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func linkedAccounts(accounts []Domain.LinkedAccount) []LinkedAccountDTO {
+	out := make([]LinkedAccountDTO, 0, len(accounts))
+	for _, a := range accounts {
+		out = append(out, LinkedAccountDTO{Provider: a.Provider, Email: a.Email, LinkedAt: a.LinkedAt})
+	}
+	return out
+}
+
+// UnlockAccountController lifts a lockout after too many failed logins
+func (UsrCtrl *UserController) UnlockAccountController(c *gin.Context) {
+	actor := c.MustGet("user").(*Domain.User)
+	if err := UsrCtrl.usecase.UnlockAccountUC(*actor, c.Param("id")); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
 }
@@ -3,15 +3,21 @@ package controllers
 import "time"
 
 type UserDTO struct {
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
-	Password string    `json:"password"`
-	Bio      string    `json:"bio"`
-	Role     string    `json:"role"`
-	Verfied  bool      `json:"verifed"`
-	OTP      string    `json:"otp"`
-	OTPTime  time.Time `json:"otptime"`
-	Provider string    `json:"provider"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Bio      string `json:"bio"`
+	Role     string `json:"role"`
+	Provider string `json:"provider"`
+}
+
+type VerifyOTPDTO struct {
+	Email string `json:"email" binding:"required"`
+	OTP   string `json:"otp" binding:"required"`
+}
+
+type ResendOTPDTO struct {
+	Email string `json:"email" binding:"required"`
 }
 
 type UpdateProfileDTO struct {
@@ -19,14 +25,61 @@ type UpdateProfileDTO struct {
 	Bio      string `json:"bio,omitempty"`
 }
 
+type ForgotPasswordDTO struct {
+	Email string `json:"email" binding:"required"`
+}
+
 type ResetTokenSDTO struct {
-	Email       string `json:"email"`
-	Token       string `json:"token"`
-	Created_at  time.Time
-	NewPassword string `json:"new_password"`
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 type RoleUpdateDTO struct {
 	Role string `json:"role" binding:"required"`
 	Email string `json:"email" binding:"required"`
-}
\ No newline at end of file
+}
+
+type SessionDTO struct {
+	ID         string    `json:"id"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type TOTPCodeDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFALoginDTO struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MagicLinkDTO struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type LinkedAccountDTO struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type ChangeEmailDTO struct {
+	NewEmail string `json:"new_email" binding:"required"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type PasswordViolationDTO struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"blog_api/Delivery/controllers"
 	"blog_api/Delivery/routers"
+	"blog_api/Domain"
 	infrastructure "blog_api/Infrastructure"
 	"blog_api/Repositories"
 	usecases "blog_api/Usecases"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,10 +19,21 @@ import (
 func main() {
 	// Initialize controllers and router
 	db := Repositories.InitializeDb()
+	// Data written before users had an ID still points at them by email
+	if err := Repositories.MigrateUserIDs(db); err != nil {
+		log.Fatalf("unable to migrate user ids: %s", err)
+	}
+	if err := Repositories.MigrateComments(db); err != nil {
+		log.Fatalf("unable to migrate comments: %s", err)
+	}
+	user_repo := Repositories.NewUserRepository(db)
+	audit_repo := Repositories.NewAuditRepository(db)
 
 	// blog dependency injection
 	blog_repo := Repositories.NewBlogRepository(db)
-	blog_usecase := usecases.NewBlogUseCase(blog_repo)
+	role_repo := Repositories.NewRoleRepository(db)
+	policy := usecases.NewPolicy(role_repo)
+	blog_usecase := usecases.NewBlogUseCase(blog_repo, user_repo, policy, audit_repo)
 	blog_controller := controllers.NewBlogController(blog_usecase)
 
 	// Get required email info from the env file
@@ -33,19 +47,208 @@ func main() {
 	Pass := os.Getenv("SMTP_PASSWORD")
 	frm := os.Getenv("SMTP_FROM")
 
-	j_serv := infrastructure.Jwt_serv{}
+	// Tokens are signed with the active key, every key in the directory still verifies
+	signing_keys, err := infrastructure.LoadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KEY_ID"), []byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		log.Fatalf("unable to load jwt signing keys: %s", err)
+	}
+	j_serv := infrastructure.NewJwtService(signing_keys)
 	generator_otp := infrastructure.Generator{}
 	password_service := infrastructure.PasswordService{}
-	mailr := infrastructure.NewMailer(Host, Port, Username, Pass, frm)
+	app_url := envOr("APP_URL", "http://localhost:8080")
+	// The page that reads the token from the link and asks for the new password
+	mailr := infrastructure.NewMailer(Host, Port, Username, Pass, frm, app_url, envOr("PASSWORD_RESET_URL", app_url+"/reset-password"))
 
 	// user dependency injection
-	user_repo := Repositories.NewUserRepository(db)
-	user_usecase := usecases.NewUserUsecase(user_repo, password_service, &mailr, generator_otp, j_serv)
+	revocation_list := infrastructure.NewRevocationCache(Repositories.NewRevocationRepository(db), 30*time.Second)
+	// Failed logins are shared between instances unless kept in memory
+	var login_attempts Domain.LoginAttemptRepositoryI = Repositories.NewLoginAttemptRepository(db)
+	if os.Getenv("LOGIN_ATTEMPT_STORE") == "memory" {
+		login_attempts = Repositories.NewMemoryLoginAttemptRepository()
+	}
+	minLength, _ := strconv.Atoi(envOr("PASSWORD_MIN_LENGTH", "8"))
+	maxLength, _ := strconv.Atoi(envOr("PASSWORD_MAX_LENGTH", "72"))
+	history, _ := strconv.Atoi(envOr("PASSWORD_HISTORY", "5"))
+	classes := []string{}
+	for _, class := range strings.Split(envOr("PASSWORD_REQUIRE", "upper,lower,digit,special"), ",") {
+		if class = strings.TrimSpace(class); class != "" && class != "none" {
+			classes = append(classes, class)
+		}
+	}
+	password_policy, err := infrastructure.NewPasswordPolicy(minLength, maxLength, classes, history, os.Getenv("PASSWORD_DENYLIST"))
+	if err != nil {
+		log.Fatalf("unable to load password policy: %s", err)
+	}
+	access_token_repo := Repositories.NewAccessTokenRepository(db)
+	user_usecase := usecases.NewUserUsecase(user_repo, password_service, &mailr, generator_otp, j_serv, policy, role_repo, revocation_list, infrastructure.NewTOTPService(envOr("TOTP_ISSUER", "Blog API")), login_attempts, password_policy, audit_repo, access_token_repo)
+
+	// role dependency injection
+	role_usecase := usecases.NewRoleUseCase(role_repo, user_repo, policy, audit_repo)
+	if err := role_usecase.EnsureDefaultRolesUC(); err != nil {
+		log.Fatalf("unable to create default roles: %s", err)
+	}
+	role_controller := controllers.NewRoleController(role_usecase)
+
+	// personal access token dependency injection
+	token_usecase := usecases.NewAccessTokenUseCase(access_token_repo, user_repo)
+	token_controller := controllers.NewAccessTokenController(token_usecase)
+
+	// oauth dependency injection
+	oauth_repo := Repositories.NewOAuthRepository(db)
+	oauth_usecase := usecases.NewOAuthUseCase(oauth_repo, user_repo, j_serv, revocation_list)
+	oauth_controller := controllers.NewOAuthController(oauth_usecase)
 
 	// auth middleware
-	middleware := infrastructure.AuthMiddleware{Usecase: user_usecase}
+	middleware := infrastructure.AuthMiddleware{Usecase: user_usecase, Tokens: token_usecase, Jwt: j_serv}
 	user_controller := controllers.NewUserController(user_usecase)
 
+	// media dependency injection
+	var blob_store Domain.BlobStore
+	if os.Getenv("MEDIA_STORAGE") == "s3" {
+		blob_store, err = infrastructure.NewS3BlobStore(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET"), os.Getenv("S3_REGION"), os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	} else {
+		blob_store, err = infrastructure.NewLocalBlobStore(envOr("MEDIA_DIR", "uploads"))
+	}
+	if err != nil {
+		log.Fatalf("unable to initialize media storage: %s", err)
+	}
+	maxSize, _ := strconv.ParseInt(envOr("MEDIA_MAX_SIZE_MB", "10"), 10, 64)
+	quota, _ := strconv.ParseInt(envOr("MEDIA_QUOTA_MB", "100"), 10, 64)
+	widths := []int{}
+	for _, w := range strings.Split(envOr("IMAGE_VARIANT_WIDTHS", "320,640,1280"), ",") {
+		if width, err := strconv.Atoi(strings.TrimSpace(w)); err == nil && width > 0 {
+			widths = append(widths, width)
+		}
+	}
+	jpegQuality, _ := strconv.Atoi(envOr("IMAGE_JPEG_QUALITY", "82"))
+	maxMegapixels, _ := strconv.Atoi(envOr("IMAGE_MAX_MEGAPIXELS", "25"))
+	image_processor := infrastructure.NewImageProcessor(widths, jpegQuality, maxMegapixels*1000000)
+	media_repo := Repositories.NewMediaRepository(db)
+	media_usecase := usecases.NewMediaUseCase(media_repo, blog_repo, user_repo, blob_store, image_processor, policy, maxSize<<20, quota<<20, os.Getenv("MEDIA_BASE_URL"))
+	media_controller := controllers.NewMediaController(media_usecase, maxSize<<20)
+	go media_usecase.RunImageWorker()
+
+	// Periodically remove uploads that were never used in a blog
+	graceHours, _ := strconv.Atoi(envOr("MEDIA_ORPHAN_GRACE_HOURS", "24"))
+	go func() {
+		for range time.Tick(time.Hour) {
+			removed, err := media_usecase.CollectOrphansUC(time.Duration(graceHours) * time.Hour)
+			if err != nil {
+				log.Print("media garbage collection failed: ", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("removed %d orphaned uploads", removed)
+			}
+		}
+	}()
+
+	// Permanently remove blogs that stayed in the trash past the retention period
+	retentionDays, _ := strconv.Atoi(envOr("TRASH_RETENTION_DAYS", "30"))
+	go func() {
+		for range time.Tick(time.Hour) {
+			purged, err := blog_usecase.PurgeExpiredUC(time.Duration(retentionDays) * 24 * time.Hour)
+			if err != nil {
+				log.Print("trash purge failed: ", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("purged %d blogs from trash", purged)
+			}
+		}
+	}()
+
+	// external login providers
+	if err := infrastructure.UseOAuthProviders(oauthProviders(), envOr("OAUTH_CALLBACK_BASE_URL", app_url)); err != nil {
+		log.Fatalf("unable to configure login providers: %s", err)
+	}
+
+	// email change dependency injection
+	email_change_repo := Repositories.NewEmailChangeRepository(db)
+	email_change_usecase := usecases.NewEmailChangeUseCase(email_change_repo, user_repo, password_service, &mailr)
+	email_change_controller := controllers.NewEmailChangeController(email_change_usecase)
+
+	// data export and account deletion dependency injection
+	graceDays, _ := strconv.Atoi(envOr("ACCOUNT_DELETION_GRACE_DAYS", "14"))
+	account_usecase := usecases.NewAccountUseCase(Repositories.NewAccountRepository(db), user_repo, blog_repo, access_token_repo, oauth_repo, email_change_repo, audit_repo, media_usecase, blob_store, password_service, &mailr, time.Duration(graceDays)*24*time.Hour)
+	account_controller := controllers.NewAccountController(account_usecase)
+
+	// admin user management dependency injection
+	admin_usecase := usecases.NewAdminUseCase(user_repo, blog_repo, media_repo, access_token_repo, user_usecase, policy, audit_repo)
+	admin_controller := controllers.NewAdminController(admin_usecase)
+	audit_controller := controllers.NewAuditController(usecases.NewAuditUseCase(audit_repo))
+	go account_usecase.RunExportWorker()
+
+	// Erase accounts past their grace period and exports past their download window
+	go func() {
+		for range time.Tick(time.Hour) {
+			erased, err := account_usecase.EraseDueAccountsUC()
+			if err != nil {
+				log.Print("account erasure failed: ", err)
+			} else if erased > 0 {
+				log.Printf("erased %d accounts", erased)
+			}
+			removed, err := account_usecase.RemoveExpiredExportsUC()
+			if err != nil {
+				log.Print("export cleanup failed: ", err)
+			} else if removed > 0 {
+				log.Printf("removed %d expired exports", removed)
+			}
+		}
+	}()
+
+	// Request counts stay in process unless every instance should share them
+	var rate_limit_store Domain.RateLimitStoreI = Repositories.NewMemoryRateLimitRepository()
+	if os.Getenv("RATE_LIMIT_STORE") == "mongo" {
+		rate_limit_store = Repositories.NewRateLimitRepository(db)
+	}
+	limiter := infrastructure.NewRateLimiter(rate_limit_store)
+	var trusted_proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trusted_proxies = append(trusted_proxies, proxy)
+		}
+	}
+
 	// router
-	routers.SetupRouter(blog_controller, &user_controller, &middleware)
+	routers.SetupRouter(blog_controller, &user_controller, media_controller, role_controller, token_controller, oauth_controller, email_change_controller, account_controller, admin_controller, audit_controller, &middleware, limiter, trusted_proxies)
+}
+
+// oauthProviders reads OAUTH_PROVIDERS and the <NAME>_CLIENT_ID/<NAME>_CLIENT_SECRET of each.
+// None are enabled by default, unless Google is still set up the old way.
+func oauthProviders() []infrastructure.OAuthProviderConfig {
+	enabled := ""
+	if os.Getenv("CLIENT_ID") != "" {
+		enabled = "google"
+	}
+	configs := []infrastructure.OAuthProviderConfig{}
+	for _, name := range strings.Split(envOr("OAUTH_PROVIDERS", enabled), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := strings.ToUpper(name)
+		cfg := infrastructure.OAuthProviderConfig{
+			Name:         name,
+			ClientID:     os.Getenv(prefix + "_CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "_CLIENT_SECRET"),
+			DiscoveryURL: os.Getenv(prefix + "_DISCOVERY_URL"),
+		}
+		// Google used to be configured through CLIENT_ID, CLIENT_SECRET and CLIENT_CALLBACK_URL
+		if name == "google" && cfg.ClientID == "" {
+			cfg.ClientID = os.Getenv("CLIENT_ID")
+			cfg.ClientSecret = os.Getenv("CLIENT_SECRET")
+			cfg.CallbackURL = os.Getenv("CLIENT_CALLBACK_URL")
+		}
+		configs = append(configs, cfg)
+	}
+	return configs
+}
+
+// read an environment variable with a fallback value
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
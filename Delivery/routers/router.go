@@ -2,40 +2,40 @@ package routers
 
 import (
 	"blog_api/Delivery/controllers"
+	"blog_api/Domain"
 	infrastructure "blog_api/Infrastructure"
 	"log"
-	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/providers/google"
 )
 
-func SetupRouter(BlogCtrl *controllers.BlogController, UserCtrl *controllers.UserController, middleware *infrastructure.AuthMiddleware) {
+func SetupRouter(BlogCtrl *controllers.BlogController, UserCtrl *controllers.UserController, MediaCtrl *controllers.MediaController, RoleCtrl *controllers.RoleController, TokenCtrl *controllers.AccessTokenController, OAuthCtrl *controllers.OAuthController, EmailCtrl *controllers.EmailChangeController, AccountCtrl *controllers.AccountController, AdminCtrl *controllers.AdminController, AuditCtrl *controllers.AuditController, middleware *infrastructure.AuthMiddleware, limiter *infrastructure.RateLimiter, trustedProxies []string) {
 	// Initialize a new router
 	router := gin.Default()
-
-	// load environment
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal(".env file failed to load")
-	}
-
-	clientID := os.Getenv("CLIENT_ID")
-	clientSecret := os.Getenv("CLIENT_SECRET")
-	clientCallbackURL := os.Getenv("CLIENT_CALLBACK_URL")
-
-	if clientID == "" || clientCallbackURL == "" || clientSecret == "" {
-		log.Fatal("Environment variables (CLIENT_ID, CLIENT_SECRET, CLIENT_CALLBACK_URL) are required.")
+	// The client IP feeds the per address limits and login throttling, so
+	// only our own proxies may name it in X-Forwarded-For
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("invalid trusted proxies: %s", err)
 	}
 
-	goth.UseProviders(
-		google.New(clientID, clientSecret, clientCallbackURL),
-	)
+	// Rate limits, routes using the same policy share one count. The per
+	// address limit is a ceiling for everyone behind one IP.
+	perIP := limiter.Limit(infrastructure.RateLimitPolicy{Name: "ip", Limit: 600, Window: time.Minute, Key: infrastructure.ByIP})
+	perUser := limiter.Limit(infrastructure.RateLimitPolicy{Name: "user", Limit: 300, Window: time.Minute, Key: infrastructure.ByAPIKey})
+	logins := limiter.Limit(infrastructure.RateLimitPolicy{Name: "login", Limit: 20, Window: time.Minute, Key: infrastructure.ByIP})
+	// Endpoints that send email
+	emails := limiter.Limit(infrastructure.RateLimitPolicy{Name: "email", Limit: 5, Window: time.Hour, Key: infrastructure.ByIP})
+	// Every chat message costs AI quota
+	chat := limiter.Limit(infrastructure.RateLimitPolicy{Name: "chat", Limit: 10, Window: time.Minute, Key: infrastructure.ByUser})
+	uploads := limiter.Limit(infrastructure.RateLimitPolicy{Name: "upload", Limit: 30, Window: time.Hour, Key: infrastructure.ByUser})
+	oauthTokens := limiter.Limit(infrastructure.RateLimitPolicy{Name: "oauth_token", Limit: 60, Window: time.Minute, Key: infrastructure.ByIP})
 
 	// Set endpoints
+	router.GET("/.well-known/jwks.json", UserCtrl.JwksController)
+
 	blogRoutes := router.Group("/blog")
+	blogRoutes.Use(perIP)
 	{
 		blogRoutes.GET("/", BlogCtrl.GetAllBlogController)
 		blogRoutes.GET("/search", BlogCtrl.SearchBlogController)
@@ -46,45 +46,150 @@ func SetupRouter(BlogCtrl *controllers.BlogController, UserCtrl *controllers.Use
 		blogRoutes.GET("/:id/dislikes", BlogCtrl.DislikesController)
 		blogRoutes.GET("/popular", BlogCtrl.GetPopularBlogs)
 
-		// Authenticated Routes
+		// Authenticated Routes, personal access tokens need the matching scope
+		read := middleware.RequireScope(Domain.ScopeBlogRead)
+		write := middleware.RequireScope(Domain.ScopeBlogWrite)
 		authBlog := blogRoutes.Group("/")
-		authBlog.Use(middleware.Auth_token())
+		authBlog.Use(middleware.Auth_token(), perUser)
 		{
-			authBlog.POST("/", BlogCtrl.CreateBlogController)
-			authBlog.PUT("/", BlogCtrl.UpdateBlogController)
-			authBlog.DELETE("/:id", BlogCtrl.DeleteBlogController)
-			authBlog.GET("/:id/like", BlogCtrl.LikeBlogController)
-			authBlog.GET("/:id/dislike", BlogCtrl.DisLikeBlogController)
-			authBlog.POST("/:id/comments", BlogCtrl.CommentsBlogController)
-			authBlog.POST("/chat", BlogCtrl.AiChatBlogController)
-			authBlog.GET("/read_later", BlogCtrl.ReadLatersBlogController)
-			authBlog.POST("/:id/read_later", BlogCtrl.InsertReadLatersBlogController)
-			authBlog.GET("/liked", BlogCtrl.GetLikedController)
+			authBlog.POST("/", write, BlogCtrl.CreateBlogController)
+			authBlog.PUT("/", write, BlogCtrl.UpdateBlogController)
+			authBlog.DELETE("/:id", write, BlogCtrl.DeleteBlogController)
+			authBlog.GET("/trash", read, BlogCtrl.TrashController)
+			authBlog.POST("/:id/restore", write, BlogCtrl.RestoreBlogController)
+			authBlog.DELETE("/:id/purge", write, BlogCtrl.PurgeBlogController)
+			authBlog.GET("/:id/like", write, BlogCtrl.LikeBlogController)
+			authBlog.GET("/:id/dislike", write, BlogCtrl.DisLikeBlogController)
+			authBlog.POST("/:id/comments", middleware.RequireScope(Domain.ScopeCommentsWrite), BlogCtrl.CommentsBlogController)
+			authBlog.POST("/chat", middleware.RequireSession(), chat, BlogCtrl.AiChatBlogController)
+			authBlog.GET("/read_later", read, BlogCtrl.ReadLatersBlogController)
+			authBlog.POST("/:id/read_later", write, BlogCtrl.InsertReadLatersBlogController)
+			authBlog.GET("/liked", read, BlogCtrl.GetLikedController)
+			authBlog.PUT("/:id/cover", write, MediaCtrl.SetBlogCoverController)
+			authBlog.PUT("/:id/coauthors", write, BlogCtrl.SetCoAuthorsController)
+
+			// Editorial review workflow
+			authBlog.POST("/:id/submit", write, BlogCtrl.SubmitForReviewController)
+			authBlog.POST("/:id/publish", write, BlogCtrl.PublishBlogController)
+			authBlog.GET("/:id/preview", read, BlogCtrl.PreviewBlogController)
+			authBlog.GET("/:id/review", read, BlogCtrl.ReviewHistoryController)
+			authBlog.POST("/:id/review", write, middleware.RequirePermission(Domain.PermBlogReview), BlogCtrl.ReviewBlogController)
+			authBlog.GET("/review/queue", read, middleware.RequirePermission(Domain.PermBlogReview), BlogCtrl.ReviewQueueController)
 		}
 	}
 
 	userRoutes := router.Group("/user")
+	userRoutes.Use(perIP)
 	{
-		userRoutes.POST("/", UserCtrl.RegisterController)
-		userRoutes.POST("/verify-otp", UserCtrl.VerifyOTPController)
-		userRoutes.POST("/login", UserCtrl.LoginController)
-		userRoutes.POST("/forgot-password", UserCtrl.ForgotPasswordController)
-		userRoutes.POST("/reset-password", UserCtrl.ResetPasswordController)
+		userRoutes.POST("/", emails, UserCtrl.RegisterController)
+		userRoutes.POST("/verify-otp", logins, UserCtrl.VerifyOTPController)
+		userRoutes.POST("/resend-otp", emails, UserCtrl.ResendOTPController)
+		userRoutes.POST("/login", logins, UserCtrl.LoginController)
+		userRoutes.POST("/login/2fa", logins, UserCtrl.CompleteMFALoginController)
+		userRoutes.POST("/magic-link/request", emails, UserCtrl.RequestMagicLinkController)
+		userRoutes.GET("/magic-link", UserCtrl.CheckMagicLinkController)
+		userRoutes.POST("/magic-link", UserCtrl.MagicLinkLoginController)
+		userRoutes.POST("/forgot-password", emails, UserCtrl.ForgotPasswordController)
+		userRoutes.POST("/reset-password", logins, UserCtrl.ResetPasswordController)
 		userRoutes.GET("/auth/:provider", UserCtrl.SignInWithProvider)
 		userRoutes.GET("/auth/:provider/callback", UserCtrl.OauthCallback)
 		userRoutes.POST("/refresh", UserCtrl.RefreshController)
+		userRoutes.GET("/email/confirm", logins, EmailCtrl.CheckEmailChangeController)
+		userRoutes.POST("/email/confirm", logins, EmailCtrl.ConfirmEmailChangeController)
 
-		// Authenticated Routes
+		// Authenticated Routes, scoped tokens may only reach the profile
 		authUser := userRoutes.Group("/")
-		authUser.Use(middleware.Auth_token())
+		authUser.Use(middleware.Auth_token(), perUser)
+		{
+			authUser.GET("/me", middleware.RequireScope(Domain.ScopeProfileRead), UserCtrl.MeController)
+			authUser.PUT("/", middleware.RequireScope(Domain.ScopeProfileWrite), UserCtrl.UpdateProfileController)
+			authUser.PUT("/avatar", middleware.RequireScope(Domain.ScopeProfileWrite), MediaCtrl.SetAvatarController)
+		}
+
+		// Account management needs a full login
+		account := userRoutes.Group("/")
+		account.Use(middleware.Auth_token(), middleware.RequireSession(), perUser)
 		{
-			authUser.PUT("/", UserCtrl.UpdateProfileController)
-			authUser.POST("/logout", UserCtrl.LogoutController)
+			account.POST("/logout", UserCtrl.LogoutController)
+			account.PUT("/password", logins, UserCtrl.ChangePasswordController)
+			account.GET("/sessions", UserCtrl.ListSessionsController)
+			account.DELETE("/sessions", UserCtrl.RevokeOtherSessionsController)
+			account.DELETE("/sessions/:id", UserCtrl.RevokeSessionController)
+			account.POST("/2fa/enroll", UserCtrl.EnrollTOTPController)
+			account.POST("/2fa/confirm", UserCtrl.ConfirmTOTPController)
+			account.DELETE("/2fa", UserCtrl.DisableTOTPController)
+			account.POST("/tokens", TokenCtrl.CreateAccessTokenController)
+			account.GET("/tokens", TokenCtrl.ListAccessTokensController)
+			account.DELETE("/tokens/:id", TokenCtrl.RevokeAccessTokenController)
+			account.POST("/auth/:provider/link", UserCtrl.LinkProviderController)
+			account.DELETE("/auth/:provider", UserCtrl.UnlinkProviderController)
+			account.POST("/email", emails, EmailCtrl.RequestEmailChangeController)
+			account.DELETE("/email", EmailCtrl.CancelEmailChangeController)
+			account.POST("/export", AccountCtrl.RequestExportController)
+			account.GET("/export", AccountCtrl.ListExportsController)
+			account.GET("/export/:id/download", AccountCtrl.DownloadExportController)
+			account.POST("/deletion", AccountCtrl.ScheduleDeletionController)
+			account.GET("/deletion", AccountCtrl.GetDeletionController)
+			account.DELETE("/deletion", AccountCtrl.CancelDeletionController)
 
 			// Admin Routes
-			authUser.PUT("/role", middleware.Require_Admin(), UserCtrl.UpdateUserRoleController)
+			account.PUT("/role", middleware.RequirePermission(Domain.PermRoleAssign), UserCtrl.UpdateUserRoleController)
 		}
 	}
+
+	// OAuth 2.0 authorization server for third party apps
+	oauthRoutes := router.Group("/oauth")
+	oauthRoutes.Use(perIP)
+	{
+		oauthRoutes.POST("/token", oauthTokens, OAuthCtrl.TokenController)
+		oauthRoutes.POST("/revoke", OAuthCtrl.RevokeController)
+		oauthRoutes.POST("/introspect", OAuthCtrl.IntrospectController)
+
+		authOAuth := oauthRoutes.Group("/")
+		authOAuth.Use(middleware.Auth_token(), middleware.RequireSession(), perUser)
+		{
+			authOAuth.GET("/authorize", OAuthCtrl.ConsentController)
+			authOAuth.POST("/authorize", OAuthCtrl.AuthorizeController)
+			authOAuth.POST("/clients", OAuthCtrl.RegisterClientController)
+			authOAuth.GET("/clients", OAuthCtrl.ListClientsController)
+			authOAuth.DELETE("/clients/:id", OAuthCtrl.DeleteClientController)
+		}
+	}
+
+	mediaRoutes := router.Group("/media")
+	mediaRoutes.Use(perIP)
+	{
+		mediaRoutes.GET("/:id", MediaCtrl.GetMediaController)
+		mediaRoutes.GET("/:id/:variant", MediaCtrl.GetMediaVariantController)
+
+		// Authenticated Routes
+		authMedia := mediaRoutes.Group("/")
+		authMedia.Use(middleware.Auth_token(), perUser)
+		{
+			authMedia.POST("/", middleware.RequireScope(Domain.ScopeBlogWrite), uploads, MediaCtrl.UploadMediaController)
+			authMedia.GET("/", middleware.RequireScope(Domain.ScopeBlogRead), MediaCtrl.ListMediaController)
+			authMedia.DELETE("/:id", middleware.RequireScope(Domain.ScopeBlogWrite), MediaCtrl.DeleteMediaController)
+		}
+	}
+
+	adminRoutes := router.Group("/admin")
+	adminRoutes.Use(perIP, middleware.Auth_token(), middleware.RequireSession(), perUser)
+	{
+		adminRoutes.GET("/roles", middleware.RequirePermission(Domain.PermRoleManage), RoleCtrl.ListRolesController)
+		adminRoutes.PUT("/roles/:name", middleware.RequirePermission(Domain.PermRoleManage), RoleCtrl.SaveRoleController)
+		adminRoutes.DELETE("/roles/:name", middleware.RequirePermission(Domain.PermRoleManage), RoleCtrl.DeleteRoleController)
+		adminRoutes.PUT("/users/roles", middleware.RequirePermission(Domain.PermRoleAssign), RoleCtrl.AssignRolesController)
+		adminRoutes.GET("/users", middleware.RequirePermission(Domain.PermUserManage), AdminCtrl.ListUsersController)
+		adminRoutes.GET("/users/:id", middleware.RequirePermission(Domain.PermUserManage), AdminCtrl.GetUserController)
+		adminRoutes.POST("/users/:id/logout", middleware.RequirePermission(Domain.PermUserManage), AdminCtrl.ForceLogoutController)
+		adminRoutes.POST("/users/:id/password-reset", middleware.RequirePermission(Domain.PermUserManage), AdminCtrl.TriggerPasswordResetController)
+		adminRoutes.POST("/users/:id/suspension", middleware.RequirePermission(Domain.PermUserBan), AdminCtrl.SuspendUserController)
+		adminRoutes.DELETE("/users/:id/suspension", middleware.RequirePermission(Domain.PermUserBan), AdminCtrl.UnsuspendUserController)
+		adminRoutes.POST("/users/:id/unlock", middleware.RequirePermission(Domain.PermUserBan), UserCtrl.UnlockAccountController)
+		adminRoutes.GET("/audit", middleware.RequirePermission(Domain.PermAuditRead), AuditCtrl.QueryAuditController)
+		adminRoutes.GET("/audit/export", middleware.RequirePermission(Domain.PermAuditRead), AuditCtrl.ExportAuditController)
+		adminRoutes.GET("/audit/verify", middleware.RequirePermission(Domain.PermAuditRead), AuditCtrl.VerifyAuditController)
+	}
 	// Run the router
 	router.Run()
 }
@@ -5,39 +5,161 @@ import (
 )
 
 type User struct {
+	// ID never changes, everything that belongs to a user points to it
+	ID       string
 	Username string
 	Email    string
 	Password string
 	Bio      string
 	Role     string
+	Roles    []string
 	Verfied  bool
-	OTP      string
-	OTPTime  time.Time
 	Provider string
+	Avatar   *Image
+	// Identities at external login providers that can sign into this account
+	LinkedAccounts []LinkedAccount
+	// Two factor authentication, the secret is only set once enrollment started
+	TOTPSecret     string `json:"-"`
+	TOTPEnabled    bool
+	TOTPLastStep   int64     `json:"-"`
+	RecoveryCodes  []string  `json:"-"`
+	MFAFailures    int       `json:"-"`
+	MFALockedUntil time.Time `json:"-"`
+	// Email verification code, only its hash is stored
+	OTPHash        string    `json:"-"`
+	OTPExpiresAt   time.Time `json:"-"`
+	OTPSentAt      time.Time `json:"-"`
+	OTPFailures    int       `json:"-"`
+	OTPLockedUntil time.Time `json:"-"`
+	// Hashes of earlier passwords, newest first, so they aren't chosen again
+	PasswordHistory []string `json:"-"`
+	// Unknown for accounts created before it was recorded
+	CreatedAt  time.Time
+	Suspension *Suspension
+	// Device is the client of the current request, set by the auth middleware and never stored
+	Device DeviceInfo `bson:"-" json:"-"`
+}
+
+// Suspension keeps a user out until it ends, a ban is a suspension without an end
+type Suspension struct {
+	Reason string
+	// ID of the admin who suspended the user
+	By    string
+	At    time.Time
+	Until *time.Time
+}
+
+// ActiveAt reports whether the suspension still applies at t
+func (s *Suspension) ActiveAt(t time.Time) bool {
+	return s != nil && (s.Until == nil || t.Before(*s.Until))
+}
+
+// UserActivity sums up what a user has done, for admins looking at the account
+type UserActivity struct {
+	Blogs          int
+	PublishedBlogs int
+	TrashedBlogs   int
+	ReviewComments int
+	Reactions      int
+	ReadingList    int
+	Sessions       int
+	AccessTokens   int
+	Uploads        int
+	StorageUsed    int64
+}
+
+// Author is what readers get to see about the user who wrote a blog
+type Author struct {
+	ID       string
+	Username string
+	Avatar   *Image
+}
+
+// DeletedUserID owns the blogs and uploads an erased account left behind
+const DeletedUserID = "deleted"
+
+// LinkedAccount is an identity at an external login provider
+type LinkedAccount struct {
+	Provider string
+	Subject  string
+	Email    string
+	LinkedAt time.Time
 }
 
 type Blog struct {
-	ID          string
-	Title       string
-	Content     string
-	Owner_email string
-	Tags        []string
-	Date        time.Time
-	ViewCount   int
-	Comments    []string
+	ID      string
+	Title   string
+	Content string
+	OwnerID string
+	// Author is looked up for responses and never stored
+	Author *Author `bson:"-"`
+	// User IDs of the co-authors
+	CoAuthors  []string
+	Tags       []string
+	Date       time.Time
+	ViewCount  int
+	Comments   []Comment
+	Status     string
+	Revision   int
+	CoverImage *Image
+	DeletedAt  *time.Time
+}
+
+// Comment is a reader's comment on a blog. Comments from before authors were
+// recorded have no AuthorID.
+type Comment struct {
+	ID       string
+	AuthorID string
+	Text     string
+	Date     time.Time
+}
+
+// BlogComment is a comment together with the blog it was left on
+type BlogComment struct {
+	BlogID  string
+	Comment Comment
 }
 
+// Review states a blog moves through before it becomes public
+const (
+	StatusDraft            = "draft"
+	StatusInReview         = "in_review"
+	StatusChangesRequested = "changes_requested"
+	StatusApproved         = "approved"
+	StatusPublished        = "published"
+)
+
+type ReviewComment struct {
+	ID         string
+	BlogID     string
+	Revision   int
+	ReviewerID string
+	Comment    string
+	Date       time.Time
+}
+
+type ReviewTransition struct {
+	BlogID   string
+	From     string
+	To       string
+	ActorID  string
+	Revision int
+	Date     time.Time
+}
+
+// ResetTokenS is a hashed single use password reset token
 type ResetTokenS struct {
-	Email       string
-	Token       string
-	Created_at  time.Time
-	NewPassword string
+	UserID    string
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
 }
 
 type LikeTracker struct {
-	BlogID    string
-	UserEmail string
-	Liked     int
+	BlogID string
+	UserID string
+	Liked  int
 }
 
 type ChatRequest struct {
@@ -49,6 +171,66 @@ type ChatResponse struct {
 }
 
 type ReadLater struct {
-	BlogIds   string
-	UserEmail string
+	BlogIds string
+	UserID  string
+}
+
+type Media struct {
+	ID          string
+	OwnerID     string
+	Key         string
+	Filename    string
+	ContentType string
+	Size        int64
+	URL         string
+	Date        time.Time
+	Width       int
+	Height      int
+	BlurHash    string
+	Variants    []ImageVariant
+	Processed   bool
+}
+
+// ImageVariant is a resized copy of an uploaded image
+type ImageVariant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Key         string
+	URL         string
+	Size        int64
+}
+
+// Image is what blogs and users expose for covers and avatars
+type Image struct {
+	MediaID  string
+	URL      string
+	Width    int
+	Height   int
+	BlurHash string
+	Variants []ImageVariant
+}
+
+// ProcessedImage is the output of the image pipeline before it is stored
+type ProcessedImage struct {
+	Width    int
+	Height   int
+	BlurHash string
+	Variants []EncodedVariant
+}
+
+type EncodedVariant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Role is a named set of permissions that can be assigned to users
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
 }
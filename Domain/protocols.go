@@ -1,10 +1,128 @@
 package Domain
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/markbates/goth"
 )
 
+// ErrForbidden is returned by usecases whenever the policy denies an action
+var ErrForbidden = errors.New("you are not allowed to perform this action")
+
+// Actions checked through PolicyI
+const (
+	ActionBlogCreate      = "blog:create"
+	ActionBlogRead        = "blog:read"
+	ActionBlogComment     = "blog:comment"
+	ActionBlogUpdate      = "blog:update"
+	ActionBlogDelete      = "blog:delete"
+	ActionBlogRestore     = "blog:restore"
+	ActionBlogPurge       = "blog:purge"
+	ActionBlogSubmit      = "blog:submit"
+	ActionBlogReview      = "blog:review"
+	ActionBlogPublish     = "blog:publish"
+	ActionBlogQueue       = "blog:queue"
+	ActionBlogViewReviews = "blog:view_reviews"
+	ActionBlogCover       = "blog:cover"
+	ActionBlogCoAuthors   = "blog:coauthors"
+	ActionMediaUse        = "media:use"
+	ActionMediaDelete     = "media:delete"
+	ActionUserUpdate      = "user:update"
+	ActionUserRole        = "user:role"
+	ActionUserManage      = "user:manage"
+	ActionUserSuspend     = "user:suspend"
+	ActionRoleManage      = "role:manage"
+)
+
+// Permissions granted through roles
+const (
+	PermAll             = "*"
+	PermBlogReview      = "blog:review"
+	PermBlogPublish     = "blog:publish"
+	PermBlogModerate    = "blog:moderate"
+	PermCommentModerate = "comment:moderate"
+	PermMediaModerate   = "media:moderate"
+	PermUserBan         = "user:ban"
+	PermUserManage      = "user:manage"
+	PermAuditRead       = "audit:read"
+	PermRoleManage      = "role:manage"
+	PermRoleAssign      = "role:assign"
+)
+
+var Permissions = []string{
+	PermAll,
+	PermBlogReview,
+	PermBlogPublish,
+	PermBlogModerate,
+	PermCommentModerate,
+	PermMediaModerate,
+	PermUserBan,
+	PermUserManage,
+	PermAuditRead,
+	PermRoleManage,
+	PermRoleAssign,
+}
+
+// Scopes limit what a token that is not a full login may do
+const (
+	ScopeBlogRead      = "blog:read"
+	ScopeBlogWrite     = "blog:write"
+	ScopeCommentsWrite = "comments:write"
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+)
+
+var Scopes = []string{
+	ScopeBlogRead,
+	ScopeBlogWrite,
+	ScopeCommentsWrite,
+	ScopeProfileRead,
+	ScopeProfileWrite,
+}
+
+// ScopeDescriptions are shown to users on the OAuth consent screen
+var ScopeDescriptions = map[string]string{
+	ScopeBlogRead:      "Read your trash, reading list, liked blogs and uploads",
+	ScopeBlogWrite:     "Create, edit, publish and delete your blogs",
+	ScopeCommentsWrite: "Comment on blogs as you",
+	ScopeProfileRead:   "See your profile",
+	ScopeProfileWrite:  "Change your profile and avatar",
+}
+
+// AccessTokenPrefix tells personal access tokens apart from JWTs
+const AccessTokenPrefix = "bpat_"
+
+type PolicyI interface {
+	Can(user User, action string, resource interface{}) bool
+	HasPermission(user User, permission string) bool
+	// Invalidate drops any cached role definitions
+	Invalidate()
+}
+
+type RoleRepositoryI interface {
+	UpsertRole(role Role) error
+	InsertRoleIfMissing(role Role) error
+	GetRole(name string) (Role, error)
+	GetRoles() ([]Role, error)
+	DeleteRole(name string) error
+	CountUsersWithRole(name string) (int64, error)
+}
+
+type RoleUseCaseI interface {
+	EnsureDefaultRolesUC() error
+	ListRolesUC() ([]Role, error)
+	SaveRoleUC(actor User, role Role) error
+	DeleteRoleUC(actor User, name string) error
+	AssignRolesUC(actor User, email string, roles []string) (*User, error)
+}
+
 type BlogRepositoryI interface {
 	Create(blog *Blog) error
 	UpdateBlog(updatedBlog *Blog) error
@@ -12,71 +130,348 @@ type BlogRepositoryI interface {
 	SearchBlog(searchBlog *Blog) ([]Blog, error)
 	DeleteBlog(id string) error
 	FilterBlog(filterBlog *Blog) ([]Blog, error)
+	// GetBlog finds drafts too, GetPublishedBlog only what readers can see
 	GetBlog(id string) (Blog, error)
-	FindLiked(user_email, blog_id string) (*LikeTracker, error)
+	GetPublishedBlog(id string) (Blog, error)
+	FindLiked(userID, blog_id string) (*LikeTracker, error)
 	CreateLikeTk(lt LikeTracker) error
 	DeleteLikeTk(lt LikeTracker) error
 	NumberOfDislikes(id string) (int64, error)
 	NumberOfLikes(id string) (int64, error)
-	GetLiked(email string) ([]string, error)
+	GetLiked(userID string) ([]string, error)
 	// GetPopularBlogs() ([]Blog, error)
-	FetchReadLaterBlog(email string) ([]string, error)
+	FetchReadLaterBlog(userID string) ([]string, error)
 	StoreReadLaterBlog(blog ReadLater) error
+	UpdateBlogStatus(id, status string) error
+	GetBlogsByStatus(status string) ([]Blog, error)
+	StoreTransition(tr ReviewTransition) error
+	GetTransitions(blogID string) ([]ReviewTransition, error)
+	StoreReviewComment(comment ReviewComment) error
+	GetReviewComments(blogID string) ([]ReviewComment, error)
+	ReferencesMedia(id, url string) (bool, error)
+	UpdateBlogCover(id string, cover *Image) error
+	RefreshCoverImage(cover Image) error
+	RestoreBlog(id string) error
+	GetTrashedBlog(id string) (Blog, error)
+	GetTrashedBlogs(ownerID string) ([]Blog, error)
+	GetTrashedBefore(date time.Time) ([]Blog, error)
+	PurgeBlog(id string) error
+	IncrementViewCount(id string) error
+	AddComment(id string, comment Comment) error
+	GetCommentsBy(authorID string) ([]BlogComment, error)
+	DeleteCommentsBy(authorID string) error
+	ReassignComments(fromID, toID string) error
+	UpdateCoAuthors(id string, coAuthors []string) error
+	// GetBlogsByOwner includes drafts and blogs in the trash
+	GetBlogsByOwner(ownerID string) ([]Blog, error)
+	GetReactions(userID string) ([]LikeTracker, error)
+	GetReviewCommentsBy(reviewerID string) ([]ReviewComment, error)
+	ReassignBlogs(fromID, toID string) error
+	// ForgetUser drops the user's reactions and reading list, takes them off
+	// co-authored blogs and credits their reviews to replacementID
+	ForgetUser(userID, replacementID string) error
 }
 
 type BlogUseCaseI interface {
-	CreateBlogUC(Blog) error
-	UpdateBlogUC(Blog) error
+	CreateBlogUC(blog Blog, actor User) error
+	UpdateBlogUC(blog Blog, actor User) error
 	GetAllBlogUC(limit int, offset int) ([]Blog, error)
 	SearchBlogUC(Blog) ([]Blog, error)
-	DeleteBlogUC(string) error
+	DeleteBlogUC(id string, actor User) error
 	FilterBlogUC(Blog) ([]Blog, error)
 	GetByIdBlogUC(string) (Blog, error)
+	// PreviewBlogUC shows a blog that may not be published yet to those allowed to see it
+	PreviewBlogUC(id string, actor User) (Blog, error)
 	AIChatBlogUC(ChatRequest) (*string, error)
-	CheckIfLiked(user_email, blogId string) (int, error)
+	CheckIfLiked(userID, blogId string) (int, error)
 	AddLikeUC(LikeTracker) error
 	Dislikes(id string) (int64, error)
 	Likes(id string) (int64, error)
 	GetPopularBlogs() ([]Blog, error)
-	FetchFromReadLater(email string) ([]Blog, error)
-	AddToReadLater(email, id string) error
-	GetLikedUC(email string) ([]Blog, error)
+	FetchFromReadLater(userID string) ([]Blog, error)
+	AddToReadLater(userID, id string) error
+	GetLikedUC(userID string) ([]Blog, error)
+	SubmitForReviewUC(id string, actor User) error
+	ReviewBlogUC(id string, actor User, decision, comment string) error
+	PublishBlogUC(id string, actor User) error
+	GetReviewQueueUC(actor User) ([]Blog, error)
+	GetReviewHistoryUC(id string, actor User) ([]ReviewTransition, []ReviewComment, error)
+	GetTrashUC(ownerID string) ([]Blog, error)
+	RestoreBlogUC(id string, actor User) error
+	PurgeBlogUC(id string, actor User) error
+	PurgeExpiredUC(retention time.Duration) (int, error)
+	ViewBlogUC(id string) error
+	AddCommentUC(id string, actor User, comment string) error
+	SetCoAuthorsUC(id string, actor User, coAuthors []string) error
 }
 
 type UserRepositoryI interface {
 	CheckExistence(email string) error
 	Register(user *User) error
 	GetUser(user *User) (*User, error)
-	UpdateUser(user *User) error
 	DeleteUser(email string) error
-	ForgotPassword(data ResetTokenS) error
-	GetTokenData(email string) (ResetTokenS, error)
+	// EraseUser removes the account together with its sessions and pending links
+	EraseUser(id, email string) error
+	// FindUsers returns one page of the matching users and how many match in total
+	FindUsers(filter UserFilter) ([]User, int64, error)
+	// SetSuspension lifts the suspension when it is nil
+	SetSuspension(id string, suspension *Suspension) error
+	// StoreResetToken replaces any reset token the user still had
+	StoreResetToken(token ResetTokenS) error
+	GetResetToken(tokenHash string) (ResetTokenS, error)
+	// ConsumeResetToken reports false when the token was already used
+	ConsumeResetToken(tokenHash string) (bool, error)
 	DeleteTokenData(email string) error
-	UpdatePassword(email, password string) error
+	// UpdatePassword also replaces the hashes of earlier passwords
+	UpdatePassword(id, password string, history []string) error
 	StoreToken(RefreshTokenStorage) error
-	GetRefreshToken(string) (string, error)
+	GetRefreshToken(tokenHash string) (RefreshTokenStorage, error)
+	MarkRefreshTokenUsed(tokenHash string) (bool, error)
+	RevokeTokenFamily(familyID string) error
+	CreateSession(session Session) error
+	TouchSession(id string, device DeviceInfo) error
+	GetSession(id string) (Session, error)
+	GetSessions(userID string) ([]Session, error)
+	RevokeSession(id string) error
+	RevokeSessions(userID, exceptID string) error
+	RevokeClientSessions(clientID string) error
 	GetUserByEmail(email string) (*User, error)
+	GetUserByID(id string) (*User, error)
+	GetUsersByIDs(ids []string) ([]User, error)
+	// RenameEmail moves the account to a new address, pending reset and
+	// sign in links for the old one are dropped
+	RenameEmail(oldEmail, newEmail string) error
 	UpdateUserProfile(user *User) (*User, error)
 	UpdateUserRole(email string, role string) (*User, error)
-	DeleteToken(email string) error
-	AddToBlackList(token, email string) error
-	DeleteFromBlackList(email string) error
-	RetriveFromBlackList(email string) (string, error)
+	UpdateUserRoles(email string, roles []string) (*User, error)
+	DeleteToken(userID string) error
+	UpdateUserAvatar(id string, avatar *Image) error
+	RefreshAvatar(avatar Image) error
+	HasAvatar(mediaID string) (bool, error)
+	SetTOTP(id, secret string, enabled bool, recoveryCodes []string) error
+	ConsumeTOTPStep(id string, step int64) (bool, error)
+	UseRecoveryCode(id, codeHash string) (bool, error)
+	IncrementMFAFailures(id string) (int, error)
+	LockMFA(id string, until time.Time) error
+	ResetMFAFailures(id string) error
+	StoreMagicLink(link MagicLink) error
+	GetMagicLink(tokenHash string) (MagicLink, error)
+	ConsumeMagicLink(tokenHash string) (MagicLink, error)
+	CountMagicLinks(email string, since time.Time) (int64, error)
+	GetUserByLinkedAccount(provider, subject string) (*User, error)
+	AddLinkedAccount(id string, account LinkedAccount) error
+	RemoveLinkedAccount(id, provider string) error
+	SetVerified(email string) error
+	SetOTP(email, otpHash string, expiresAt time.Time) error
+	IncrementOTPFailures(email string) (int, error)
+	LockOTP(email string, until time.Time) error
 }
 
 type UserUsecaseI interface {
 	RegisterUsecase(user *User) error
-	VerifyOTPUsecase(user *User) error
-	LoginUsecase(user *User) (map[string]string, error)
+	VerifyOTPUsecase(email, otp string) error
+	ResendOTPUsecase(email string) error
+	// UnlockAccountUC takes the user's ID, or their email
+	UnlockAccountUC(actor User, id string) error
+	LoginUsecase(user *User, device DeviceInfo) (map[string]string, error)
 	ForgotPasswordUsecase(email string) error
-	ResetPasswordUsecase(data ResetTokenS) error
-	OauthCallbackUsecase(user *goth.User) (map[string]string, error)
+	ResetPasswordUsecase(token, newPassword string, device DeviceInfo) error
+	ChangePasswordUC(user User, sessionID, currentPassword, newPassword string) error
+	OauthCallbackUsecase(user *goth.User, device DeviceInfo) (map[string]string, error)
 	GetUserByEmail(email string) (*User, error)
-	UpdateProfileUsecase(user *User) (*User, error)
-	UpdateUserRole(email string, role string) (*User, error)
-	RefreshUseCase(refreshToken string) (map[string]string, error)
-	LogoutUseCase(email, accessToken string) error
-	RetriveFromBlackList(email string) (string, error)
+	GetUserByID(id string) (*User, error)
+	// UpdateProfileUsecase changes the username and bio of the user with the
+	// ID of update, fields left empty keep their value
+	UpdateProfileUsecase(actor User, update User) (*User, error)
+	UpdateUserRole(actor User, email string, role string) (*User, error)
+	RefreshUseCase(refreshToken string, device DeviceInfo) (map[string]string, error)
+	LogoutUseCase(user User, sessionID, accessToken string) error
+	ListSessionsUC(userID string) ([]Session, error)
+	RevokeSessionUC(userID, id string) error
+	RevokeOtherSessionsUC(userID, currentID string) error
+	IsSessionActive(id string) bool
+	IsTokenRevoked(jti string) bool
+	PublicKeysUC() []JWK
+	EnrollTOTPUC(email string) (string, string, error)
+	ConfirmTOTPUC(user User, code string) ([]string, error)
+	DisableTOTPUC(user User, code string) error
+	CompleteMFALoginUC(mfaToken, code string, device DeviceInfo) (map[string]string, error)
+	RequestMagicLinkUC(email string) error
+	CheckMagicLinkUC(token string) (time.Time, error)
+	MagicLinkLoginUC(token string, device DeviceInfo) (map[string]string, error)
+	CreateLinkTokenUC(email, provider string) (string, error)
+	LinkProviderUC(linkToken string, identity *goth.User) error
+	UnlinkProviderUC(email, provider string) error
+	HasPermission(user User, permission string) bool
+}
+
+type AccessTokenRepositoryI interface {
+	StoreAccessToken(token AccessToken) error
+	GetAccessToken(tokenHash string) (AccessToken, error)
+	GetAccessTokens(userID string) ([]AccessToken, error)
+	DeleteAccessToken(id, userID string) error
+	// DeleteAccessTokens removes every token of the user and reports how many there were
+	DeleteAccessTokens(userID string) (int64, error)
+	TouchAccessToken(id string, at time.Time) error
+}
+
+type AccessTokenUseCaseI interface {
+	CreateAccessTokenUC(userID, name string, scopes []string, ttl time.Duration) (AccessToken, string, error)
+	ListAccessTokensUC(userID string) ([]AccessToken, error)
+	RevokeAccessTokenUC(userID, id string) error
+	AuthenticateUC(token string) (*User, AccessToken, error)
+}
+
+type OAuthRepositoryI interface {
+	StoreClient(client OAuthClient) error
+	GetClient(id string) (OAuthClient, error)
+	GetClients(ownerID string) ([]OAuthClient, error)
+	DeleteClient(id, ownerID string) error
+	StoreCode(code OAuthCode) error
+	ConsumeCode(codeHash string) (OAuthCode, error)
+}
+
+type OAuthUseCaseI interface {
+	RegisterClientUC(owner string, client OAuthClient) (OAuthClient, string, error)
+	ListClientsUC(owner string) ([]OAuthClient, error)
+	DeleteClientUC(owner, id string) error
+	ConsentUC(req AuthorizeRequest) (OAuthClient, []string, error)
+	AuthorizeUC(user User, req AuthorizeRequest, approve bool) (string, error)
+	TokenUC(req TokenRequest, device DeviceInfo) (map[string]string, error)
+	RevokeUC(clientID, clientSecret, token string) error
+	IntrospectUC(clientID, clientSecret, token string) (Introspection, error)
+}
+
+type MediaRepositoryI interface {
+	StoreMedia(media Media) error
+	GetMedia(id string) (Media, error)
+	GetUserMedia(ownerID string) ([]Media, error)
+	GetMediaBefore(date time.Time) ([]Media, error)
+	DeleteMedia(id string) error
+	UpdateMedia(media Media) error
+}
+
+type MediaUseCaseI interface {
+	UploadMediaUC(owner, filename string, size int64, file io.Reader) (Media, error)
+	GetMediaUC(id string) (Media, []byte, error)
+	ListMediaUC(owner string) ([]Media, error)
+	DeleteMediaUC(id string, actor User) error
+	CollectOrphansUC(gracePeriod time.Duration) (int, error)
+	GetMediaVariantUC(id, name string) (ImageVariant, []byte, error)
+	ProcessImageUC(id string) error
+	SetBlogCoverUC(blogID, mediaID string, actor User) (*Image, error)
+	SetAvatarUC(mediaID string, actor User) (*Image, error)
+	ReleaseUploadsUC(ownerID string) error
+}
+
+type ImageProcessorI interface {
+	// Sanitize returns the image without its metadata, in the same format
+	Sanitize(data []byte, contentType string) ([]byte, error)
+	Process(data []byte, contentType string) (ProcessedImage, error)
+}
+
+// BlobStore keeps the raw bytes of uploaded files
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// LoginAttemptRepositoryI counts failed logins per key, an account or an IP address.
+// Locking a key starts its count over.
+type LoginAttemptRepositoryI interface {
+	GetAttempts(key string) (LoginAttempts, error)
+	RecordFailure(key string, at time.Time) (LoginAttempts, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+type EmailChangeRepositoryI interface {
+	// StoreEmailChange replaces any change the user still had pending
+	StoreEmailChange(change EmailChange) error
+	GetEmailChange(tokenHash string) (EmailChange, error)
+	// ConfirmEmailChange marks the old or the new address as confirmed
+	ConfirmEmailChange(id string, oldAddress bool) (EmailChange, error)
+	DeleteEmailChange(email string) error
+}
+
+type EmailChangeUseCaseI interface {
+	RequestEmailChangeUC(user User, sessionID, newEmail, password string) error
+	CheckEmailChangeUC(token string) (EmailChange, error)
+	ConfirmEmailChangeUC(token string) (EmailChange, error)
+	CancelEmailChangeUC(email string) error
+}
+
+type AdminUseCaseI interface {
+	ListUsersUC(filter UserFilter) ([]User, int64, error)
+	GetUserDetailUC(id string) (*User, UserActivity, error)
+	SuspendUserUC(actor User, id, reason string, until *time.Time) (*User, error)
+	UnsuspendUserUC(actor User, id string) (*User, error)
+	ForceLogoutUC(actor User, id string) (int64, error)
+	TriggerPasswordResetUC(actor User, id string) error
+}
+
+// AuditRepositoryI stores the audit log. Entries can only be appended, each
+// one chained to the one before it.
+type AuditRepositoryI interface {
+	// AppendAuditEntry sets the Seq, PrevHash and Hash of the entry
+	AppendAuditEntry(entry AuditEntry) error
+	FindAuditEntries(filter AuditFilter) ([]AuditEntry, error)
+	// StreamAuditEntries calls fn for every matching entry, oldest first, and
+	// stops at the first error fn returns
+	StreamAuditEntries(filter AuditFilter, fn func(AuditEntry) error) error
+	// EraseActorDetails forgets the IP and user agent of an erased account,
+	// neither is part of the chain
+	EraseActorDetails(actorID string) error
+}
+
+type AuditUseCaseI interface {
+	QueryAuditUC(filter AuditFilter) ([]AuditEntry, error)
+	ExportAuditUC(filter AuditFilter, fn func(AuditEntry) error) error
+	VerifyAuditUC() (AuditVerification, error)
+}
+
+// AccountRepositoryI keeps data export jobs and scheduled account deletions
+type AccountRepositoryI interface {
+	StoreExport(export DataExport) error
+	GetExport(id string) (DataExport, error)
+	GetUserExports(userID string) ([]DataExport, error)
+	GetExportsByStatus(statuses ...string) ([]DataExport, error)
+	GetExportsBefore(date time.Time) ([]DataExport, error)
+	UpdateExport(export DataExport) error
+	DeleteExport(id string) error
+	// ScheduleDeletion replaces any deletion the user already scheduled
+	ScheduleDeletion(deletion AccountDeletion) error
+	GetDeletion(userID string) (AccountDeletion, error)
+	GetDeletionsDue(date time.Time) ([]AccountDeletion, error)
+	// DeleteDeletion reports false when nothing was scheduled
+	DeleteDeletion(userID string) (bool, error)
+}
+
+type AccountUseCaseI interface {
+	RequestExportUC(user User) (DataExport, error)
+	ListExportsUC(userID string) ([]DataExport, error)
+	DownloadExportUC(userID, id string) (DataExport, []byte, error)
+	BuildExportUC(id string) error
+	RemoveExpiredExportsUC() (int, error)
+	ScheduleDeletionUC(user User, password, posts string) (AccountDeletion, error)
+	GetDeletionUC(userID string) (AccountDeletion, error)
+	CancelDeletionUC(userID string) error
+	EraseDueAccountsUC() (int, error)
+}
+
+// RateLimitStoreI counts requests per key in fixed windows, the limiter
+// weighs the previous window in to get a sliding one
+type RateLimitStoreI interface {
+	// Hit counts a request in the window beginning at start and returns the
+	// counts of that window and of the one before
+	Hit(key string, start time.Time, window time.Duration) (current, previous int64, err error)
+}
+
+// RevocationListI remembers access tokens that were signed out before they expired
+type RevocationListI interface {
+	Revoke(token RevokedToken) error
+	IsRevoked(jti string) (bool, error)
 }
 
 type PasswordServiceI interface {
@@ -86,19 +481,388 @@ type PasswordServiceI interface {
 
 type MailerI interface {
 	SendOTPEmail(toEmail, otp string) error
-	SendResetPassEmail(toEmail, token string) error
+	SendResetPassEmail(toEmail, token string, ttl time.Duration) error
+	SendMagicLinkEmail(toEmail, token string) error
+	SendAccountLockedEmail(toEmail string, until time.Time) error
+	SendEmailChangeEmail(toEmail, newEmail, token string) error
+	SendAccountDeletionEmail(toEmail string, at time.Time) error
+	SendExportReadyEmail(toEmail string) error
 }
 
 type JwtServI interface {
-	CreateToken(user User) (map[string]string, error)
+	CreateToken(user User, session Session) (map[string]string, error)
 	ParseToken(string) (*jwt.Token, error)
 	IsExpired(*jwt.Token) bool
+	PublicKeys() []JWK
+	CreateChallengeToken(user User, purpose string) (string, error)
+}
+
+// TOTPServiceI implements RFC 6238 time based one time passwords
+type TOTPServiceI interface {
+	GenerateSecret() (string, error)
+	URI(secret, account string) string
+	Validate(secret, code string, at time.Time) (int64, bool)
+	GenerateRecoveryCodes(n int) ([]string, error)
+}
+
+// PasswordPolicyI decides which new passwords are acceptable
+type PasswordPolicyI interface {
+	// Check returns a *PasswordPolicyError naming every rule the password breaks
+	Check(password string) error
+	// History is how many of the latest passwords can't be chosen again
+	History() int
 }
 
 type GeneratorI interface {
 	GenerateOTP() string
 }
+
+// RefreshTokenStorage is a hashed refresh token. Every login starts a new
+// family, each refresh rotates to a new token in the same family.
 type RefreshTokenStorage struct {
-	Email string
-	Token string
+	UserID    string
+	TokenHash string
+	FamilyID  string
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// Session is one signed in device. Its ID is the refresh token family ID.
+// Sessions started by an OAuth client carry the client and granted scopes.
+type Session struct {
+	ID         string
+	UserID     string
+	ClientID   string
+	Scopes     []string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// RevokedToken is a signed out access token, kept only until it would have expired anyway
+type RevokedToken struct {
+	JTI       string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// AccessToken is a personal access token used by scripts instead of a login.
+// Only its hash is stored, the token itself is shown once when created.
+type AccessToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+// OAuthClient is a third party app that may act for users who consent.
+// Public clients such as mobile apps have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID           string
+	SecretHash   string
+	Name         string
+	OwnerID      string
+	RedirectURIs []string
+	Scopes       []string
+	Public       bool
+	CreatedAt    time.Time
+}
+
+// OAuthCode is a hashed single use authorization code
+type OAuthCode struct {
+	CodeHash    string
+	ClientID    string
+	UserID      string
+	RedirectURI string
+	// RedirectURIGiven is set when the authorization request named the
+	// redirect uri, the token request then has to name it too
+	RedirectURIGiven bool
+	Scopes           []string
+	CodeChallenge    string
+	ExpiresAt        time.Time
+}
+
+// AuthorizeRequest holds the parameters of /oauth/authorize
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest holds the parameters of /oauth/token
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	ClientID     string
+	ClientSecret string
+}
+
+// Introspection is the RFC 7662 view of a token
+type Introspection struct {
+	Active    bool
+	Scope     string
+	ClientID  string
+	Subject   string
+	Username  string
+	TokenType string
+	Exp       int64
+}
+
+// OAuthError is an error reported with an RFC 6749 error code
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+// LoginAttempts are the recent failed logins for one key
+type LoginAttempts struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Rules of the password policy, reported in PasswordPolicyError
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleMaxLength = "max_length"
+	PasswordRuleUpper     = "uppercase"
+	PasswordRuleLower     = "lowercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSpecial   = "special"
+	PasswordRuleCommon    = "common"
+	PasswordRuleReused    = "reused"
+)
+
+// PasswordViolation is one password rule a new password broke
+type PasswordViolation struct {
+	Rule    string
+	Message string
+}
+
+// PasswordPolicyError lists every rule a new password broke
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the password policy"
+}
+
+// ThrottledError is returned while logins are refused after too many failures
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// SuspendedError refuses tokens to a suspended user
+type SuspendedError struct {
+	Reason string
+	Until  *time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	return "account suspended"
+}
+
+// EmailChange is a pending change of a user's address. Links are sent to the
+// old and the new address and it is applied once both were opened.
+type EmailChange struct {
+	ID           string
+	Email        string
+	NewEmail     string
+	OldTokenHash string
+	NewTokenHash string
+	OldConfirmed bool
+	NewConfirmed bool
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// MagicLink is a hashed single use sign in token sent by email
+type MagicLink struct {
+	UserID string
+	// Email is the address it was sent to, links per address are limited
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// JWK is a public verification key as published at /.well-known/jwks.json
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// DeviceInfo describes the client a token is issued to
+type DeviceInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// States of a data export
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is a ZIP archive of everything stored about a user, built in
+// the background and kept in the blob store until it expires
+type DataExport struct {
+	ID         string
+	UserID     string
+	Status     string
+	Key        string
+	Size       int64
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// What happens to the blogs of an erased account
+const (
+	PostsDelete    = "delete"
+	PostsAnonymize = "anonymize"
+)
+
+// AccountDeletion is an account the user asked to delete. It is erased at
+// DeleteAt unless the user cancels before.
+type AccountDeletion struct {
+	UserID      string
+	Posts       string
+	RequestedAt time.Time
+	DeleteAt    time.Time
+}
+
+// UserFilter narrows down the users admins look through, empty fields match everyone
+type UserFilter struct {
+	// Query is part of the username or email
+	Query    string
+	Role     string
+	Provider string
+	Verified *bool
+	// Suspended only counts suspensions that have not ended
+	Suspended     *bool
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// Actions written to the audit log
+const (
+	AuditUserRole             = "user.role"
+	AuditUserRoles            = "user.roles"
+	AuditUserUnlock           = "user.unlock"
+	AuditUserSuspend          = "user.suspend"
+	AuditUserUnsuspend        = "user.unsuspend"
+	AuditUserForceLogout      = "user.force_logout"
+	AuditPasswordChange       = "user.password_change"
+	AuditPasswordReset        = "user.password_reset"
+	AuditPasswordResetTrigger = "user.password_reset_trigger"
+	AuditTOTPEnable           = "user.2fa_enable"
+	AuditTOTPDisable          = "user.2fa_disable"
+	AuditBlogDelete           = "blog.delete"
+	AuditBlogRestore          = "blog.restore"
+	AuditBlogPurge            = "blog.purge"
+	AuditBlogReview           = "blog.review"
+	AuditBlogPublish          = "blog.publish"
+	AuditBlogCoAuthors        = "blog.coauthors"
+	AuditRoleSave             = "role.save"
+	AuditRoleDelete           = "role.delete"
+)
+
+// AuditEntry records who did what to which record. Entries are never
+// changed or removed once written, except that the client details of an
+// erased account are blanked.
+type AuditEntry struct {
+	ID string
+	// Seq numbers the entries without gaps, starting at 1
+	Seq  int64
+	Time time.Time
+	// ActorID is empty for what the server did on its own
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	UserAgent  string
+	// JSON snapshots of the target, empty when there is nothing to show
+	Before string
+	After  string
+	// Hash covers PrevHash and every field above except IP and UserAgent
+	PrevHash string
+	Hash     string
+}
+
+// ChainHash is the hash the entry must carry, given the PrevHash it has
+func (e AuditEntry) ChainHash() string {
+	// Stored times lose everything below a millisecond
+	fields, _ := json.Marshal([]string{
+		e.PrevHash,
+		strconv.FormatInt(e.Seq, 10),
+		e.ID,
+		e.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.Before,
+		e.After,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditVerification is the result of walking the audit chain. BrokenAt is
+// the sequence number of the first entry that was changed, or follows a
+// removed one.
+type AuditVerification struct {
+	Entries  int64
+	Valid    bool
+	BrokenAt int64
+}
+
+// AuditFilter narrows down the audit log, empty fields match every entry
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
 }
@@ -4,29 +4,59 @@ import (
 	"blog_api/Domain"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 )
 
 type AuthMiddleware struct {
 	Usecase Domain.UserUsecaseI
+	Tokens  Domain.AccessTokenUseCaseI
+	Jwt     Domain.JwtServI
 }
 
-func (am AuthMiddleware) Require_Admin() gin.HandlerFunc {
+// RequirePermission only lets through users whose roles grant the permission
+func (am AuthMiddleware) RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, ok := c.Get("user")
-		role := user.(*Domain.User).Role
-		if ok && role == "admin" {
+		if ok && am.Usecase.HasPermission(*user.(*Domain.User), permission) {
 			c.Next()
 			return
 		}
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "you need to be an admin to view this site"})
+		c.JSON(http.StatusForbidden, gin.H{"error": Domain.ErrForbidden.Error()})
 		c.Abort()
 	}
 }
 
+// RequireScope limits scoped tokens to routes their scopes cover. A normal
+// login is not scoped and always passes.
+func (am AuthMiddleware) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, scoped := c.Get("scopes")
+		if !scoped || slices.Contains(scopes.([]string), scope) {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "token is missing the " + scope + " scope"})
+		c.Abort()
+	}
+}
+
+// RequireSession keeps scoped tokens away from account management
+func (am AuthMiddleware) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, scoped := c.Get("scopes"); scoped {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint needs a full login"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func (am AuthMiddleware) Auth_token() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -41,8 +71,11 @@ func (am AuthMiddleware) Auth_token() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		jwt_serv := Jwt_serv{}
-		token, err := jwt_serv.ParseToken(authParts[1])
+		if strings.HasPrefix(authParts[1], Domain.AccessTokenPrefix) {
+			am.authAccessToken(c, authParts[1])
+			return
+		}
+		token, err := am.Jwt.ParseToken(authParts[1])
 		if err != nil {
 			fmt.Printf("error: %v", err)
 			c.JSON(401, gin.H{"error: ": "Unauthorized access"})
@@ -50,7 +83,7 @@ func (am AuthMiddleware) Auth_token() gin.HandlerFunc {
 			return
 		}
 
-		if jwt_serv.IsExpired(token) {
+		if am.Jwt.IsExpired(token) {
 			c.JSON(401, gin.H{"error: ": "Access token expired."})
 			c.Abort()
 			return
@@ -73,21 +106,75 @@ func (am AuthMiddleware) Auth_token() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		userEmail := claims["email"].(string)
-		existingToken, err := am.Usecase.RetriveFromBlackList(userEmail)
-		if err != nil && existingToken == authParts[1] {
+		userID, _ := claims["sub"].(string)
+		userEmail, _ := claims["email"].(string)
+		// Tokens issued before revocation existed carry no jti and simply run out
+		if jti, _ := claims["jti"].(string); jti != "" && am.Usecase.IsTokenRevoked(jti) {
 			c.JSON(401, gin.H{"error: ": "User logged out. Please Login Again."})
 			c.Abort()
 			return
 		}
-		user, err := am.Usecase.GetUserByEmail(userEmail)
+		// Tokens issued before sessions existed carry no session id
+		if sessionID, _ := claims["sid"].(string); sessionID != "" {
+			if !am.Usecase.IsSessionActive(sessionID) {
+				c.JSON(401, gin.H{"error": "Session revoked. Please Login Again."})
+				c.Abort()
+				return
+			}
+			c.Set("session_id", sessionID)
+		}
+		// Tokens issued to OAuth clients are limited to the granted scopes
+		if scope, ok := claims["scope"].(string); ok {
+			c.Set("scopes", strings.Fields(scope))
+			c.Set("client_id", claims["client_id"])
+		}
+		var user *Domain.User
+		if userID != "" {
+			user, err = am.Usecase.GetUserByID(userID)
+		} else {
+			// Tokens issued before users had an ID only name the email
+			user, err = am.Usecase.GetUserByEmail(userEmail)
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
+		if rejectSuspended(c, user) {
+			return
+		}
+		user.Device = Domain.DeviceInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
 
 		c.Set("user", user)
 		c.Next()
 	}
 }
+
+// authAccessToken signs the request in with a personal access token
+func (am AuthMiddleware) authAccessToken(c *gin.Context, secret string) {
+	user, token, err := am.Tokens.AuthenticateUC(secret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if rejectSuspended(c, user) {
+		return
+	}
+	user.Device = Domain.DeviceInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+	c.Set("role", user.Role)
+	c.Set("scopes", token.Scopes)
+	c.Set("access_token_id", token.ID)
+	c.Set("user", user)
+	c.Next()
+}
+
+// rejectSuspended turns away a suspended user whose token is otherwise still valid
+func rejectSuspended(c *gin.Context, user *Domain.User) bool {
+	if !user.Suspension.ActiveAt(time.Now()) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "account suspended", "reason": user.Suspension.Reason, "until": user.Suspension.Until})
+	c.Abort()
+	return true
+}
@@ -0,0 +1,41 @@
+package infrastructure
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	texttemplate "text/template"
+)
+
+// resetPasswordData fills the password reset templates
+type resetPasswordData struct {
+	Link      string
+	ExpiresIn string
+}
+
+var resetPasswordText = texttemplate.Must(texttemplate.New("reset_password.txt").Parse(`Someone asked to reset the password of your account. Open this link to choose a new one, it expires in {{.ExpiresIn}} and works once:
+
+{{.Link}}
+
+Resetting signs you out on every device. If you did not ask for it you can ignore this email, your password stays the same.
+`))
+
+var resetPasswordHTML = htmltemplate.Must(htmltemplate.New("reset_password.html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; line-height: 1.5;">
+	<p>Someone asked to reset the password of your account.</p>
+	<p><a href="{{.Link}}" style="display: inline-block; padding: 10px 16px; background: #2563eb; color: #ffffff; text-decoration: none; border-radius: 4px;">Choose a new password</a></p>
+	<p>The link expires in {{.ExpiresIn}} and works once. Resetting signs you out on every device.</p>
+	<p style="color: #6b7280;">If you did not ask for it you can ignore this email, your password stays the same.</p>
+</body>
+</html>
+`))
+
+// render runs a text or html template into a string
+func render(tmpl interface {
+	Execute(io.Writer, any) error
+}, data any) (string, error) {
+	var out bytes.Buffer
+	err := tmpl.Execute(&out, data)
+	return out.String(), err
+}
@@ -0,0 +1,233 @@
+package infrastructure
+
+import (
+	"blog_api/Domain"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/buckket/go-blurhash"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageProcessor strips any metadata (EXIF, GPS, ...) from uploads by
+// decoding and re-encoding the pixels, and resizes them into the configured widths
+type ImageProcessor struct {
+	widths    []int
+	quality   int
+	maxPixels int
+}
+
+func NewImageProcessor(widths []int, quality, maxPixels int) ImageProcessor {
+	return ImageProcessor{
+		widths:    widths,
+		quality:   quality,
+		maxPixels: maxPixels,
+	}
+}
+
+// decode reads the dimensions from the header first, a small file can claim
+// enough pixels to exhaust memory once decoded
+func (ip ImageProcessor) decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("invalid image")
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > ip.maxPixels/config.Height {
+		return nil, errors.New("image dimensions too large")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("invalid image")
+	}
+	return img, nil
+}
+
+// Sanitize re-encodes an upload so none of its metadata is kept, turning
+// JPEGs upright first. It runs before the upload is stored.
+func (ip ImageProcessor) Sanitize(data []byte, contentType string) ([]byte, error) {
+	if contentType == "image/gif" {
+		// GIFs carry no EXIF and re-encoding would drop their animation
+		config, err := gif.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.New("invalid image")
+		}
+		if config.Width <= 0 || config.Height <= 0 || config.Width > ip.maxPixels/config.Height {
+			return nil, errors.New("image dimensions too large")
+		}
+		return data, nil
+	}
+	img, err := ip.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	switch contentType {
+	case "image/jpeg":
+		return ip.encodeJPEG(applyOrientation(img, jpegOrientation(data)))
+	case "image/png":
+		return encodePNG(img)
+	case "image/webp":
+		return encodeWebP(img)
+	}
+	return nil, errors.New("unsupported image type")
+}
+
+// Process makes the resized variants and blurhash of an image Sanitize already cleaned
+func (ip ImageProcessor) Process(data []byte, contentType string) (Domain.ProcessedImage, error) {
+	var result Domain.ProcessedImage
+	img, err := ip.decode(data)
+	if err != nil {
+		return result, err
+	}
+	bounds := img.Bounds()
+	result.Width, result.Height = bounds.Dx(), bounds.Dy()
+
+	for _, width := range ip.widths {
+		if width >= result.Width {
+			continue
+		}
+		height := result.Height * width / result.Width
+		if height < 1 {
+			height = 1
+		}
+		resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+
+		jpg, err := ip.encodeJPEG(resized)
+		if err != nil {
+			return result, err
+		}
+		webp, err := encodeWebP(resized)
+		if err != nil {
+			return result, err
+		}
+		result.Variants = append(result.Variants,
+			Domain.EncodedVariant{Width: width, Height: height, ContentType: "image/jpeg", Extension: ".jpg", Data: jpg},
+			Domain.EncodedVariant{Width: width, Height: height, ContentType: "image/webp", Extension: ".webp", Data: webp},
+		)
+	}
+
+	// Blurhash only needs a tiny copy of the image
+	thumbWidth := 32
+	thumbHeight := result.Height * thumbWidth / result.Width
+	if thumbHeight < 1 {
+		thumbHeight = 1
+	}
+	thumb := image.NewNRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	draw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, bounds, draw.Src, nil)
+	result.BlurHash, err = blurhash.Encode(4, 3, thumb)
+	return result, err
+}
+
+func (ip ImageProcessor) encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: ip.quality})
+	return buf.Bytes(), err
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+func encodeWebP(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := nativewebp.Encode(&buf, img, nil)
+	return buf.Bytes(), err
+}
+
+// jpegOrientation reads the EXIF orientation tag, returning 1 when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns the pixels so the image displays upright without EXIF
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
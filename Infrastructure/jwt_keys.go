@@ -0,0 +1,166 @@
+package infrastructure
+
+import (
+	"blog_api/Domain"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey is one entry of the key set. Keys loaded from a public key file
+// can only verify.
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are
+// still accepted from. Rotating means adding a new key, making it active and
+// removing the old one once the tokens it signed have expired.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	// legacy verifies HS256 tokens that were issued without a kid header
+	legacy []byte
+}
+
+// LoadKeySet reads every <kid>.pem file in dir. Private RSA keys sign with
+// RS256, Ed25519 keys with EdDSA. Without a directory tokens are signed with
+// the HS256 secret.
+func LoadKeySet(dir, activeID string, secret []byte) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*signingKey), legacy: secret}
+	if dir == "" {
+		if len(secret) == 0 {
+			return nil, errors.New("either a signing key directory or a jwt secret is required")
+		}
+		ks.active = &signingKey{method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+		return ks, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		key, err := loadSigningKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ks.keys[key.id] = key
+	}
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found in %s", activeID, dir)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+func loadSigningKey(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verify = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verify = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	return key, nil
+}
+
+// Sign signs the claims with the active key and names it in the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.id != "" {
+		token.Header["kid"] = ks.active.id
+	}
+	return token.SignedString(ks.active.sign)
+}
+
+// Keyfunc picks the verification key named by the token's kid header
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok || len(ks.legacy) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return ks.legacy, nil
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// Never let the token pick a different algorithm than the key was made for
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+// PublicKeys lists every asymmetric verification key as a JWK
+func (ks *KeySet) PublicKeys() []Domain.JWK {
+	keys := []Domain.JWK{}
+	for _, key := range ks.keys {
+		jwk := Domain.JWK{Kid: key.id, Alg: key.method.Alg(), Use: "sig"}
+		switch k := key.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
@@ -2,39 +2,59 @@ package infrastructure
 
 import (
 	"blog_api/Domain"
-	"fmt"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-type Jwt_serv struct{}
+type Jwt_serv struct {
+	keys *KeySet
+}
+
+const accessTokenTTL = time.Hour
 
-var JwtSecret = []byte("blog api is amazing")
+// Challenge tokens prove one step, like a password accepted before the second factor
+const challengeTokenTTL = 5 * time.Minute
+
+func NewJwtService(keys *KeySet) Jwt_serv {
+	return Jwt_serv{keys: keys}
+}
 
-func (js Jwt_serv) CreateToken(user Domain.User) (map[string]string, error) {
+func (js Jwt_serv) CreateToken(user Domain.User, session Domain.Session) (map[string]string, error) {
 	tokens := make(map[string]string)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"exp":   time.Now().Add(time.Hour * 1).Unix(),
+	claims := jwt.MapClaims{
+		"exp":   time.Now().Add(accessTokenTTL).Unix(),
+		"sub":   user.ID,
 		"role":  user.Role,
 		"email": user.Email,
 		"type":  "access",
-	})
-
-	t, err := token.SignedString(JwtSecret)
+		"sid":   session.ID,
+		// Lets a single access token be revoked on logout
+		"jti": uuid.New().String(),
+	}
+	// Tokens handed to OAuth clients only reach what the user consented to
+	if session.ClientID != "" {
+		claims["client_id"] = session.ClientID
+		claims["scope"] = strings.Join(session.Scopes, " ")
+	}
+	t, err := js.keys.Sign(claims)
 	if err != nil {
 		return tokens, err
 	}
 
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
+	rtClaims := jwt.MapClaims{}
 	rtClaims["exp"] = time.Now().Add(24 * time.Hour).Unix()
-	rtClaims["sub"] = user.Email
-	rtClaims["iat"] = time.Now()
+	rtClaims["sub"] = user.ID
+	rtClaims["iat"] = time.Now().Unix()
 	rtClaims["email"] = user.Email
 	rtClaims["type"] = "refresh"
+	rtClaims["sid"] = session.ID
+	// Unique id so no two refresh tokens are ever identical
+	rtClaims["jti"] = uuid.New().String()
 
-	rt, err := refreshToken.SignedString(JwtSecret)
+	rt, err := js.keys.Sign(rtClaims)
 	if err != nil {
 		return tokens, err
 	}
@@ -43,14 +63,19 @@ func (js Jwt_serv) CreateToken(user Domain.User) (map[string]string, error) {
 	return tokens, nil
 }
 
-func (js Jwt_serv) ParseToken(token string) (*jwt.Token, error) {
-	ptoken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return JwtSecret, nil
+// CreateChallengeToken proves a single step for the user, its purpose is the token type
+func (js Jwt_serv) CreateChallengeToken(user Domain.User, purpose string) (string, error) {
+	return js.keys.Sign(jwt.MapClaims{
+		"exp":   time.Now().Add(challengeTokenTTL).Unix(),
+		"sub":   user.ID,
+		"email": user.Email,
+		"type":  purpose,
+		"jti":   uuid.New().String(),
 	})
-	return ptoken, err
+}
+
+func (js Jwt_serv) ParseToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, js.keys.Keyfunc)
 }
 
 func (js Jwt_serv) IsExpired(token *jwt.Token) bool {
@@ -63,3 +88,7 @@ func (js Jwt_serv) IsExpired(token *jwt.Token) bool {
 	// Convert exp to time.Time and compare
 	return time.Unix(int64(exp), 0).Before(time.Now())
 }
+
+func (js Jwt_serv) PublicKeys() []Domain.JWK {
+	return js.keys.PublicKeys()
+}
@@ -0,0 +1,58 @@
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBlobStore keeps uploaded files in a directory on disk
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+func (ls *LocalBlobStore) path(key string) (string, error) {
+	p := filepath.Join(ls.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(ls.root)+string(os.PathSeparator)) {
+		return "", errors.New("invalid object key")
+	}
+	return p, nil
+}
+
+func (ls *LocalBlobStore) Put(key string, data []byte, contentType string) error {
+	p, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (ls *LocalBlobStore) Get(key string) ([]byte, error) {
+	p, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (ls *LocalBlobStore) Delete(key string) error {
+	p, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package infrastructure
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	gomail "gopkg.in/mail.v2"
 )
@@ -12,15 +15,21 @@ type Mailer struct{
 	smtpUsername string
 	smtpPass  string
 	from  string
+	// appURL is where links in emails point to
+	appURL string
+	// resetURL is the page where users choose a new password
+	resetURL string
 }
 
-func NewMailer(Host string, Port int, Username, Pass, frm string) Mailer {
+func NewMailer(Host string, Port int, Username, Pass, frm, appURL, resetURL string) Mailer {
 	return Mailer{
 		smtpHost: Host,
 		smtpPort: Port,
 		smtpUsername: Username,
 		smtpPass: Pass,
 		from: frm,
+		appURL: strings.TrimRight(appURL, "/"),
+		resetURL: resetURL,
 	}
 }
 
@@ -38,15 +47,113 @@ func (m *Mailer) SendOTPEmail(toEmail, otp string) error {
 	return dialer.DialAndSend(message)
 }
 
-func (m *Mailer) SendResetPassEmail(toEmail, token string) error {
+// SendResetPassEmail sends a link to the reset page, the token only ever appears in the link
+func (m *Mailer) SendResetPassEmail(toEmail, token string, ttl time.Duration) error {
+	link, err := url.Parse(m.resetURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	data := resetPasswordData{Link: link.String(), ExpiresIn: ttl.String()}
+	if ttl%time.Minute == 0 {
+		data.ExpiresIn = fmt.Sprintf("%d minutes", int(ttl.Minutes()))
+	}
+	text, err := render(resetPasswordText, data)
+	if err != nil {
+		return err
+	}
+	html, err := render(resetPasswordHTML, data)
+	if err != nil {
+		return err
+	}
+	message := gomail.NewMessage()
+
+	// Compose message
+	message.SetHeader("From", m.from)
+	message.SetHeader("To", toEmail)
+	message.SetHeader("Subject", "Reset your password")
+	message.SetBody("text/plain", text)
+	message.AddAlternative("text/html", html)
+
+	// Set up the smtp dialer
+	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
+	return dialer.DialAndSend(message)
+}
+func (m *Mailer) SendMagicLinkEmail(toEmail, token string) error {
+	link := fmt.Sprintf("%s/user/magic-link?token=%s", m.appURL, url.QueryEscape(token))
 	message := gomail.NewMessage()
 
 	// Compose message
 	message.SetHeader("From", m.from)
 	message.SetHeader("To", toEmail)
-	message.SetHeader("Subject", fmt.Sprintf("Reset your email using this token, it expires in 10 Minutes.%v", token))
+	message.SetHeader("Subject", "Your sign in link")
+	message.SetBody("text/plain", fmt.Sprintf("Use this link to sign in, it expires in 15 minutes and works once:\n\n%s\n\nIf you did not ask for it you can ignore this email.", link))
 
-	// Set up the smtp dialer 
+	// Set up the smtp dialer
 	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
 	return dialer.DialAndSend(message)
-}
\ No newline at end of file
+}
+
+func (m *Mailer) SendAccountLockedEmail(toEmail string, until time.Time) error {
+	message := gomail.NewMessage()
+
+	// Compose message
+	message.SetHeader("From", m.from)
+	message.SetHeader("To", toEmail)
+	message.SetHeader("Subject", "Your account was locked")
+	message.SetBody("text/plain", fmt.Sprintf("There were too many failed attempts to sign into your account, so signing in with a password is blocked until %s.\n\nIf this wasn't you, consider resetting your password once the lock is lifted.", until.UTC().Format(time.RFC1123)))
+
+	// Set up the smtp dialer
+	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
+	return dialer.DialAndSend(message)
+}
+
+// SendEmailChangeEmail asks the old and the new address to confirm a change
+func (m *Mailer) SendEmailChangeEmail(toEmail, newEmail, token string) error {
+	link := fmt.Sprintf("%s/user/email/confirm?token=%s", m.appURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Someone asked to change the email address of your account to %s. Open this link to confirm, it expires in 24 hours:\n\n%s\n\nThe change is applied once the link sent to the new address was opened as well. If this wasn't you, change your password.", newEmail, link)
+	if toEmail == newEmail {
+		body = fmt.Sprintf("Open this link to confirm this address for your account, it expires in 24 hours:\n\n%s\n\nThe change is applied once the link sent to your current address was opened as well. If you did not ask for it you can ignore this email.", link)
+	}
+	message := gomail.NewMessage()
+
+	// Compose message
+	message.SetHeader("From", m.from)
+	message.SetHeader("To", toEmail)
+	message.SetHeader("Subject", "Confirm your new email address")
+	message.SetBody("text/plain", body)
+
+	// Set up the smtp dialer
+	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
+	return dialer.DialAndSend(message)
+}
+
+func (m *Mailer) SendAccountDeletionEmail(toEmail string, at time.Time) error {
+	message := gomail.NewMessage()
+
+	// Compose message
+	message.SetHeader("From", m.from)
+	message.SetHeader("To", toEmail)
+	message.SetHeader("Subject", "Your account will be deleted")
+	message.SetBody("text/plain", fmt.Sprintf("Your account and everything personal stored with it will be deleted on %s.\n\nChanged your mind? Sign in and cancel the deletion before then. If this wasn't you, sign in, cancel it and change your password.", at.UTC().Format(time.RFC1123)))
+
+	// Set up the smtp dialer
+	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
+	return dialer.DialAndSend(message)
+}
+
+func (m *Mailer) SendExportReadyEmail(toEmail string) error {
+	message := gomail.NewMessage()
+
+	// Compose message
+	message.SetHeader("From", m.from)
+	message.SetHeader("To", toEmail)
+	message.SetHeader("Subject", "Your data export is ready")
+	message.SetBody("text/plain", fmt.Sprintf("The copy of your data you asked for is ready. Sign in and download it from %s/user/export within 7 days.", m.appURL))
+
+	// Set up the smtp dialer
+	dialer := gomail.NewDialer(m.smtpHost, m.smtpPort, m.smtpUsername, m.smtpPass)
+	return dialer.DialAndSend(message)
+}
@@ -0,0 +1,67 @@
+package infrastructure
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/gitlab"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/microsoftonline"
+	"github.com/markbates/goth/providers/openidConnect"
+)
+
+// OAuthProviderConfig holds the credentials of one login provider
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	// CallbackURL overrides the default <base>/user/auth/<name>/callback
+	CallbackURL string
+	// DiscoveryURL is the .well-known/openid-configuration of a generic OIDC provider
+	DiscoveryURL string
+}
+
+// UseOAuthProviders registers the configured login providers with goth.
+// Providers without credentials are left out so the API still starts.
+func UseOAuthProviders(configs []OAuthProviderConfig, callbackBase string) error {
+	providers := []goth.Provider{}
+	for _, cfg := range configs {
+		if cfg.ClientID == "" || cfg.ClientSecret == "" {
+			log.Printf("oauth provider %s has no client id or secret, it is disabled", cfg.Name)
+			continue
+		}
+		callback := cfg.CallbackURL
+		if callback == "" {
+			callback = strings.TrimRight(callbackBase, "/") + "/user/auth/" + cfg.Name + "/callback"
+		}
+
+		switch cfg.Name {
+		case "google":
+			providers = append(providers, google.New(cfg.ClientID, cfg.ClientSecret, callback, "email", "profile"))
+		case "github":
+			providers = append(providers, github.New(cfg.ClientID, cfg.ClientSecret, callback, "read:user", "user:email"))
+		case "gitlab":
+			providers = append(providers, gitlab.New(cfg.ClientID, cfg.ClientSecret, callback, "read_user"))
+		case "microsoft":
+			provider := microsoftonline.New(cfg.ClientID, cfg.ClientSecret, callback, "User.Read")
+			provider.SetName("microsoft")
+			providers = append(providers, provider)
+		case "oidc":
+			if cfg.DiscoveryURL == "" {
+				return fmt.Errorf("oauth provider oidc needs a discovery url")
+			}
+			provider, err := openidConnect.NewNamed("oidc", cfg.ClientID, cfg.ClientSecret, callback, cfg.DiscoveryURL, "openid", "email", "profile")
+			if err != nil {
+				return err
+			}
+			providers = append(providers, provider)
+		default:
+			return fmt.Errorf("unknown oauth provider %q", cfg.Name)
+		}
+	}
+	goth.UseProviders(providers...)
+	return nil
+}
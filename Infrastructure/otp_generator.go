@@ -1,18 +1,18 @@
 package infrastructure
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
 type Generator struct{}
 
-// Generate OTP
-func (g Generator) GenerateOTP() string {
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
-	otp := r.Intn(899999) + 100000
+var otpRange = big.NewInt(1000000)
 
-	return fmt.Sprintf("%06d", otp)
-}
\ No newline at end of file
+// Generate a six digit OTP
+func (g Generator) GenerateOTP() string {
+	// crypto/rand does not fail since Go 1.24
+	n, _ := rand.Int(rand.Reader, otpRange)
+	return fmt.Sprintf("%06d", n.Int64())
+}
@@ -0,0 +1,132 @@
+package infrastructure
+
+import (
+	"blog_api/Domain"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Character classes a password policy can require
+const (
+	ClassUpper   = "upper"
+	ClassLower   = "lower"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+// PasswordPolicy checks new passwords against configurable rules
+type PasswordPolicy struct {
+	MinLength int
+	// bcrypt ignores everything past 72 bytes
+	MaxLength int
+	Require   []string
+	history   int
+	denylist  map[string]bool
+}
+
+// NewPasswordPolicy uses the bundled list of common passwords, extended by the
+// words in denylistFile when it is set, one per line
+func NewPasswordPolicy(minLength, maxLength int, require []string, history int, denylistFile string) (*PasswordPolicy, error) {
+	for _, class := range require {
+		switch class {
+		case ClassUpper, ClassLower, ClassDigit, ClassSpecial:
+		default:
+			return nil, fmt.Errorf("unknown character class %q", class)
+		}
+	}
+	if maxLength <= 0 || maxLength > 72 {
+		maxLength = 72
+	}
+	policy := &PasswordPolicy{
+		MinLength: min(max(minLength, 1), maxLength),
+		MaxLength: maxLength,
+		Require:   require,
+		history:   max(history, 0),
+		denylist:  map[string]bool{},
+	}
+	policy.addDenied(commonPasswords)
+	if denylistFile != "" {
+		extra, err := os.ReadFile(denylistFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.addDenied(string(extra))
+	}
+	return policy, nil
+}
+
+func (pp *PasswordPolicy) addDenied(list string) {
+	for _, word := range strings.Split(list, "\n") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			pp.denylist[word] = true
+		}
+	}
+}
+
+func (pp *PasswordPolicy) History() int {
+	return pp.history
+}
+
+func (pp *PasswordPolicy) Check(password string) error {
+	violations := []Domain.PasswordViolation{}
+	if utf8.RuneCountInString(password) < pp.MinLength {
+		violations = append(violations, Domain.PasswordViolation{Rule: Domain.PasswordRuleMinLength, Message: fmt.Sprintf("must be at least %d characters long", pp.MinLength)})
+	}
+	if len(password) > pp.MaxLength {
+		violations = append(violations, Domain.PasswordViolation{Rule: Domain.PasswordRuleMaxLength, Message: fmt.Sprintf("must be at most %d bytes long", pp.MaxLength)})
+	}
+
+	has := map[string]bool{}
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			has[ClassUpper] = true
+		case unicode.IsLower(char):
+			has[ClassLower] = true
+		case unicode.IsDigit(char):
+			has[ClassDigit] = true
+		default:
+			has[ClassSpecial] = true
+		}
+	}
+	for _, class := range pp.Require {
+		if !has[class] {
+			violations = append(violations, classViolations[class])
+		}
+	}
+
+	if pp.isCommon(password) {
+		violations = append(violations, Domain.PasswordViolation{Rule: Domain.PasswordRuleCommon, Message: "is too common, choose a less guessable password"})
+	}
+	if len(violations) > 0 {
+		return &Domain.PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+var classViolations = map[string]Domain.PasswordViolation{
+	ClassUpper:   {Rule: Domain.PasswordRuleUpper, Message: "must contain an uppercase letter"},
+	ClassLower:   {Rule: Domain.PasswordRuleLower, Message: "must contain a lowercase letter"},
+	ClassDigit:   {Rule: Domain.PasswordRuleDigit, Message: "must contain a digit"},
+	ClassSpecial: {Rule: Domain.PasswordRuleSpecial, Message: "must contain a special character"},
+}
+
+// isCommon also catches listed words dressed up to pass the character
+// classes, such as Password1! for password
+func (pp *PasswordPolicy) isCommon(password string) bool {
+	word := strings.ToLower(password)
+	if pp.denylist[word] {
+		return true
+	}
+	stripped := strings.TrimRightFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return stripped != "" && pp.denylist[stripped]
+}
@@ -0,0 +1,112 @@
+package infrastructure
+
+import (
+	"blog_api/Domain"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey picks who a request is counted against
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitPolicy allows Limit requests per Window for each key. Routes sharing
+// a policy name share their counts.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int64
+	Window time.Duration
+	Key    RateLimitKey
+}
+
+// RateLimiter enforces policies with a sliding window: the count of the
+// previous fixed window is weighed by how much of it still overlaps.
+type RateLimiter struct {
+	Store Domain.RateLimitStoreI
+}
+
+func NewRateLimiter(store Domain.RateLimitStoreI) *RateLimiter {
+	return &RateLimiter{Store: store}
+}
+
+// ByIP counts requests per client address
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser counts requests per signed in user, or per address before Auth_token ran
+func ByUser(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		return "user:" + user.(*Domain.User).ID
+	}
+	return ByIP(c)
+}
+
+// ByAPIKey counts each personal access token and OAuth client on its own,
+// other requests per user
+func ByAPIKey(c *gin.Context) string {
+	if id := c.GetString("access_token_id"); id != "" {
+		return "token:" + id
+	}
+	if clientID, _ := c.Get("client_id"); clientID != nil && clientID != "" {
+		return fmt.Sprint("client:", clientID)
+	}
+	return ByUser(c)
+}
+
+func (rl *RateLimiter) Limit(policy RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rl.limit(c, policy, time.Now())
+	}
+}
+
+func (rl *RateLimiter) limit(c *gin.Context, policy RateLimitPolicy, now time.Time) {
+	start := now.Truncate(policy.Window)
+	current, previous, err := rl.Store.Hit(policy.Name+":"+policy.Key(c), start, policy.Window)
+	if err != nil {
+		// Losing the limiter must not take the API down with it
+		log.Print("rate limit store failed: ", err)
+		c.Next()
+		return
+	}
+	elapsed := now.Sub(start)
+	overlap := 1 - float64(elapsed)/float64(policy.Window)
+	used := float64(previous)*overlap + float64(current)
+
+	reset := policy.Window - elapsed
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+	c.Header("RateLimit-Limit", strconv.FormatInt(policy.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(max(policy.Limit-int64(math.Ceil(used)), 0), 10))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+	if used <= float64(policy.Limit) {
+		c.Next()
+		return
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds(retryAfter(previous, current, policy.Limit, elapsed, policy.Window))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded, try again later"})
+	c.Abort()
+}
+
+// retryAfter is how long until one more request fits under the limit
+func retryAfter(previous, current, limit int64, elapsed, window time.Duration) time.Duration {
+	if current < limit && previous > 0 {
+		// Still in this window, once enough of the previous one slid out
+		t := time.Duration(float64(window) * (1 - float64(limit-current-1)/float64(previous)))
+		return max(t-elapsed, time.Second)
+	}
+	// In the next window, this one's count takes the place of the previous one
+	wait := window - elapsed
+	if current >= limit && current > 0 {
+		wait += time.Duration(float64(window) * (1 - float64(limit-1)/float64(current)))
+	}
+	return max(wait, time.Second)
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
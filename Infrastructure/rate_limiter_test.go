@@ -0,0 +1,152 @@
+package infrastructure
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fixedCounts answers every hit with the same counts and remembers the last one
+type fixedCounts struct {
+	current, previous int64
+	err               error
+	key               string
+	start             time.Time
+	window            time.Duration
+}
+
+func (f *fixedCounts) Hit(key string, start time.Time, window time.Duration) (int64, int64, error) {
+	f.key, f.start, f.window = key, start, window
+	return f.current, f.previous, f.err
+}
+
+// serveLimited sends one request through the limiter at now and reports
+// whether it reached the handler
+func serveLimited(store *fixedCounts, policy RateLimitPolicy, now time.Time) (*httptest.ResponseRecorder, bool) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(store)
+	reached := false
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		limiter.limit(c, policy, now)
+	}, func(c *gin.Context) {
+		reached = true
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	router.ServeHTTP(w, req)
+	return w, reached
+}
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Limit: 10, Window: time.Minute, Key: ByIP}
+	// A quarter into the window, three quarters of the previous count still weigh in
+	now := time.Date(2026, 1, 1, 12, 0, 15, 0, time.UTC)
+	tests := []struct {
+		name              string
+		previous, current int64
+		allowed           bool
+		remaining         string
+		retryAfter        string
+	}{
+		{"first request", 0, 1, true, "9", ""},
+		{"previous window weighed in", 2, 1, true, "7", ""},
+		{"exactly at the limit", 8, 4, true, "0", ""},
+		{"old requests slid out", 12, 1, true, "0", ""},
+		{"over by the previous window", 8, 5, false, "0", "15"},
+		{"over by a fraction", 10, 3, false, "0", "9"},
+		{"over in this window alone", 0, 11, false, "0", "56"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fixedCounts{current: tt.current, previous: tt.previous}
+			w, reached := serveLimited(store, policy, now)
+			if reached != tt.allowed {
+				t.Errorf("reached the handler = %v, want %v", reached, tt.allowed)
+			}
+			wantStatus := http.StatusOK
+			if !tt.allowed {
+				wantStatus = http.StatusTooManyRequests
+			}
+			if w.Code != wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, wantStatus)
+			}
+			headers := map[string]string{
+				"RateLimit-Policy":    "10;w=60",
+				"RateLimit-Limit":     "10",
+				"RateLimit-Remaining": tt.remaining,
+				"RateLimit-Reset":     "45",
+				"Retry-After":         tt.retryAfter,
+			}
+			for name, want := range headers {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterHitsWindow(t *testing.T) {
+	store := &fixedCounts{current: 1}
+	policy := RateLimitPolicy{Name: "login", Limit: 5, Window: 10 * time.Minute, Key: ByIP}
+	serveLimited(store, policy, time.Date(2026, 1, 1, 12, 34, 56, 0, time.UTC))
+	if store.key != "login:ip:192.0.2.1" {
+		t.Errorf("key = %q", store.key)
+	}
+	if want := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC); !store.start.Equal(want) {
+		t.Errorf("start = %v, want %v", store.start, want)
+	}
+	if store.window != policy.Window {
+		t.Errorf("window = %v, want %v", store.window, policy.Window)
+	}
+}
+
+func TestRateLimiterStoreFailure(t *testing.T) {
+	store := &fixedCounts{err: errors.New("store down")}
+	policy := RateLimitPolicy{Name: "test", Limit: 1, Window: time.Minute, Key: ByIP}
+	w, reached := serveLimited(store, policy, time.Now())
+	if !reached || w.Code != http.StatusOK {
+		t.Errorf("status = %d, reached = %v, want the request let through", w.Code, reached)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("RateLimit-Limit = %q without counts", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	const window = time.Minute
+	tests := []struct {
+		name              string
+		previous, current int64
+		limit             int64
+		elapsed           time.Duration
+		want              time.Duration
+	}{
+		// Fits once 8*(1-t/60)+6 <= 10, at t = 30s
+		{"previous window slides out", 8, 5, 10, 15 * time.Second, 15 * time.Second},
+		{"previous window slides out later", 10, 5, 10, 15 * time.Second, 21 * time.Second},
+		{"at least a second", 10, 5, 10, 35500 * time.Millisecond, time.Second},
+		// This window is full, in the next one 10*(1-t/60)+1 <= 10 at t = 6s
+		{"current at the limit", 4, 10, 10, 30 * time.Second, 36 * time.Second},
+		{"current at the limit without previous", 0, 10, 10, 15 * time.Second, 51 * time.Second},
+		{"current over the limit without previous", 0, 12, 10, 15 * time.Second, time.Minute},
+		{"limit of one", 0, 1, 1, 15 * time.Second, 105 * time.Second},
+		{"end of the window", 0, 10, 10, window - time.Millisecond, 6*time.Second + time.Millisecond},
+		{"nothing counted", 0, 0, 10, 15 * time.Second, 45 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(tt.previous, tt.current, tt.limit, tt.elapsed, window)
+			if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("retryAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
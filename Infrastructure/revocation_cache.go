@@ -0,0 +1,88 @@
+package infrastructure
+
+import (
+	"blog_api/Domain"
+	"sync"
+	"time"
+)
+
+// RevocationCache sits in front of the revocation store so Auth_token does not
+// hit the database on every request. Revoked jtis are kept until their token
+// expires, tokens found to be live are only trusted for a short while so a
+// logout on another instance is picked up quickly.
+type RevocationCache struct {
+	store     Domain.RevocationListI
+	liveTTL   time.Duration
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	live      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewRevocationCache(store Domain.RevocationListI, liveTTL time.Duration) *RevocationCache {
+	return &RevocationCache{
+		store:     store,
+		liveTTL:   liveTTL,
+		revoked:   make(map[string]time.Time),
+		live:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (rc *RevocationCache) Revoke(token Domain.RevokedToken) error {
+	if err := rc.store.Revoke(token); err != nil {
+		return err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.revoked[token.JTI] = token.ExpiresAt
+	delete(rc.live, token.JTI)
+	return nil
+}
+
+func (rc *RevocationCache) IsRevoked(jti string) (bool, error) {
+	now := time.Now()
+	rc.mu.Lock()
+	rc.sweep(now)
+	if exp, ok := rc.revoked[jti]; ok && now.Before(exp) {
+		rc.mu.Unlock()
+		return true, nil
+	}
+	if until, ok := rc.live[jti]; ok && now.Before(until) {
+		rc.mu.Unlock()
+		return false, nil
+	}
+	rc.mu.Unlock()
+
+	revoked, err := rc.store.IsRevoked(jti)
+	if err != nil {
+		return false, err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if revoked {
+		// The token expires at most one access token lifetime from now
+		rc.revoked[jti] = now.Add(accessTokenTTL)
+	} else {
+		rc.live[jti] = now.Add(rc.liveTTL)
+	}
+	return revoked, nil
+}
+
+// sweep drops stale entries at most once a minute. Callers must hold mu.
+func (rc *RevocationCache) sweep(now time.Time) {
+	if now.Sub(rc.lastSweep) < time.Minute {
+		return
+	}
+	for jti, exp := range rc.revoked {
+		if !now.Before(exp) {
+			delete(rc.revoked, jti)
+		}
+	}
+	for jti, until := range rc.live {
+		if !now.Before(until) {
+			delete(rc.live, jti)
+		}
+	}
+	rc.lastSweep = now
+}
@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTPService implements RFC 6238 with the defaults authenticator apps expect:
+// SHA1, 6 digits and a 30 second period.
+type TOTPService struct {
+	issuer string
+	period int64
+	digits int
+	// skew is how many periods either side of now are still accepted
+	skew int64
+}
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func NewTOTPService(issuer string) TOTPService {
+	return TOTPService{issuer: issuer, period: 30, digits: 6, skew: 1}
+}
+
+func (ts TOTPService) GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+// URI builds the otpauth:// link authenticator apps read from a QR code
+func (ts TOTPService) URI(secret, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", ts.issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(ts.digits))
+	params.Set("period", fmt.Sprint(ts.period))
+	label := url.PathEscape(ts.issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Validate returns the time step the code belongs to, so callers can refuse a
+// code that was already used.
+func (ts TOTPService) Validate(secret, code string, at time.Time) (int64, bool) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != ts.digits {
+		return 0, false
+	}
+	current := at.Unix() / ts.period
+	for step := current - ts.skew; step <= current+ts.skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(ts.hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hotp is the RFC 4226 HMAC based one time password for a counter
+func (ts TOTPService) hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < ts.digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", ts.digits, value%mod)
+}
+
+// GenerateRecoveryCodes returns codes shaped like "abcde-fghij"
+func (ts TOTPService) GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secretEncoding.EncodeToString(raw))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
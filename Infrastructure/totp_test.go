@@ -0,0 +1,132 @@
+package infrastructure
+
+import (
+	"testing"
+	"time"
+)
+
+// The shared secret of the RFC 6238 test vectors, in base32
+var rfcSecret = secretEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPRFC6238Vectors checks the SHA1 test vectors of RFC 6238 Appendix B
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	ts := TOTPService{period: 30, digits: 8}
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := ts.Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+			if !ok {
+				t.Fatalf("code %s refused at %d", tt.code, tt.unix)
+			}
+			if step != tt.unix/30 {
+				t.Errorf("step = %d, want %d", step, tt.unix/30)
+			}
+		})
+	}
+}
+
+func TestTOTPSixDigits(t *testing.T) {
+	ts := NewTOTPService("blog")
+	// The last six digits of the vector for T = 59
+	if _, ok := ts.Validate(rfcSecret, "287082", time.Unix(59, 0)); !ok {
+		t.Error("six digit code refused")
+	}
+	if _, ok := ts.Validate(rfcSecret, "94287082", time.Unix(59, 0)); ok {
+		t.Error("eight digit code accepted")
+	}
+}
+
+func TestTOTPSkewWindow(t *testing.T) {
+	ts := NewTOTPService("blog")
+	key, err := secretEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Unix(1111111111, 0)
+	current := at.Unix() / 30
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps behind", -2, false},
+		{"one step behind", -1, true},
+		{"current step", 0, true},
+		{"one step ahead", 1, true},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ts.Validate(rfcSecret, ts.hotp(key, current+tt.offset), at)
+			if ok != tt.ok {
+				t.Fatalf("accepted = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestTOTPValidateRejects(t *testing.T) {
+	ts := NewTOTPService("blog")
+	at := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfcSecret, "287083"},
+		{"short code", rfcSecret, "28708"},
+		{"empty code", rfcSecret, ""},
+		{"invalid secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ts.Validate(tt.secret, tt.code, at); ok {
+				t.Error("code accepted")
+			}
+		})
+	}
+}
+
+func TestTOTPLowercaseSecret(t *testing.T) {
+	ts := NewTOTPService("blog")
+	lower := []byte(rfcSecret)
+	for i, b := range lower {
+		if b >= 'A' && b <= 'Z' {
+			lower[i] = b + 'a' - 'A'
+		}
+	}
+	if _, ok := ts.Validate(string(lower), "287082", time.Unix(59, 0)); !ok {
+		t.Error("code refused for a lowercase secret")
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := NewTOTPService("blog").GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not shaped like abcde-fghij", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+	}
+}
@@ -0,0 +1,85 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AccessTokenRepository struct {
+	TokenCollection *mongo.Collection
+}
+
+func NewAccessTokenRepository(db *mongo.Database) *AccessTokenRepository {
+	repo := &AccessTokenRepository{
+		TokenCollection: db.Collection("access_tokens"),
+	}
+	_, err := repo.TokenCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create access token indexes: ", err)
+	}
+	return repo
+}
+
+func (atRepo *AccessTokenRepository) StoreAccessToken(token Domain.AccessToken) error {
+	_, err := atRepo.TokenCollection.InsertOne(context.TODO(), token)
+	return err
+}
+
+func (atRepo *AccessTokenRepository) GetAccessToken(tokenHash string) (Domain.AccessToken, error) {
+	var token Domain.AccessToken
+	err := atRepo.TokenCollection.FindOne(context.TODO(), bson.M{"tokenhash": tokenHash}).Decode(&token)
+	if err != nil {
+		return token, errors.New("access token not found")
+	}
+	return token, nil
+}
+
+func (atRepo *AccessTokenRepository) GetAccessTokens(userID string) ([]Domain.AccessToken, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}})
+	cursor, err := atRepo.TokenCollection.Find(context.TODO(), bson.M{"userid": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	tokens := []Domain.AccessToken{}
+	if err := cursor.All(context.TODO(), &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (atRepo *AccessTokenRepository) DeleteAccessToken(id, userID string) error {
+	result, err := atRepo.TokenCollection.DeleteOne(context.TODO(), bson.M{"id": id, "userid": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("access token not found")
+	}
+	return nil
+}
+
+func (atRepo *AccessTokenRepository) DeleteAccessTokens(userID string) (int64, error) {
+	result, err := atRepo.TokenCollection.DeleteMany(context.TODO(), bson.M{"userid": userID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (atRepo *AccessTokenRepository) TouchAccessToken(id string, at time.Time) error {
+	_, err := atRepo.TokenCollection.UpdateOne(context.TODO(), bson.M{"id": id}, bson.M{"$set": bson.M{"lastusedat": at}})
+	return err
+}
@@ -0,0 +1,124 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AccountRepository struct {
+	ExportCollection   *mongo.Collection
+	DeletionCollection *mongo.Collection
+}
+
+func NewAccountRepository(db *mongo.Database) *AccountRepository {
+	repo := &AccountRepository{
+		ExportCollection:   db.Collection("data_exports"),
+		DeletionCollection: db.Collection("account_deletions"),
+	}
+	// Expired exports are removed by the usecase, their archives live in the blob store
+	_, err := repo.ExportCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}},
+	})
+	if err != nil {
+		log.Print("failed to create data export indexes: ", err)
+	}
+	_, err = repo.DeletionCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "deleteat", Value: 1}}},
+	})
+	if err != nil {
+		log.Print("failed to create account deletion indexes: ", err)
+	}
+	return repo
+}
+
+func (acRepo *AccountRepository) StoreExport(export Domain.DataExport) error {
+	_, err := acRepo.ExportCollection.InsertOne(context.TODO(), export)
+	return err
+}
+
+func (acRepo *AccountRepository) GetExport(id string) (Domain.DataExport, error) {
+	var export Domain.DataExport
+	err := acRepo.ExportCollection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&export)
+	return export, err
+}
+
+func (acRepo *AccountRepository) GetUserExports(userID string) ([]Domain.DataExport, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}})
+	return acRepo.findExports(bson.M{"userid": userID}, findOptions)
+}
+
+func (acRepo *AccountRepository) GetExportsByStatus(statuses ...string) ([]Domain.DataExport, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}})
+	return acRepo.findExports(bson.M{"status": bson.M{"$in": statuses}}, findOptions)
+}
+
+func (acRepo *AccountRepository) GetExportsBefore(date time.Time) ([]Domain.DataExport, error) {
+	return acRepo.findExports(bson.M{"expiresat": bson.M{"$lt": date}}, options.Find())
+}
+
+func (acRepo *AccountRepository) findExports(filter bson.M, findOptions *options.FindOptions) ([]Domain.DataExport, error) {
+	cursor, err := acRepo.ExportCollection.Find(context.TODO(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	exports := []Domain.DataExport{}
+	if err := cursor.All(context.TODO(), &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (acRepo *AccountRepository) UpdateExport(export Domain.DataExport) error {
+	_, err := acRepo.ExportCollection.ReplaceOne(context.TODO(), bson.M{"id": export.ID}, export)
+	return err
+}
+
+func (acRepo *AccountRepository) DeleteExport(id string) error {
+	_, err := acRepo.ExportCollection.DeleteOne(context.TODO(), bson.M{"id": id})
+	return err
+}
+
+func (acRepo *AccountRepository) ScheduleDeletion(deletion Domain.AccountDeletion) error {
+	_, err := acRepo.DeletionCollection.ReplaceOne(context.TODO(), bson.M{"userid": deletion.UserID}, deletion, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (acRepo *AccountRepository) GetDeletion(userID string) (Domain.AccountDeletion, error) {
+	var deletion Domain.AccountDeletion
+	err := acRepo.DeletionCollection.FindOne(context.TODO(), bson.M{"userid": userID}).Decode(&deletion)
+	return deletion, err
+}
+
+func (acRepo *AccountRepository) GetDeletionsDue(date time.Time) ([]Domain.AccountDeletion, error) {
+	cursor, err := acRepo.DeletionCollection.Find(context.TODO(), bson.M{"deleteat": bson.M{"$lte": date}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	deletions := []Domain.AccountDeletion{}
+	if err := cursor.All(context.TODO(), &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (acRepo *AccountRepository) DeleteDeletion(userID string) (bool, error) {
+	result, err := acRepo.DeletionCollection.DeleteOne(context.TODO(), bson.M{"userid": userID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
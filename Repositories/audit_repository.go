@@ -0,0 +1,134 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How often an append is retried when another writer took the next sequence number
+const auditAppendAttempts = 5
+
+// AuditRepository only ever inserts, apart from blanking the client details of
+// erased accounts. Each entry carries the hash of the one before it, so an
+// entry that is changed or removed in the database breaks the chain.
+type AuditRepository struct {
+	AuditCollection *mongo.Collection
+}
+
+func NewAuditRepository(db *mongo.Database) *AuditRepository {
+	repo := &AuditRepository{
+		AuditCollection: db.Collection("audit_log"),
+	}
+	_, err := repo.AuditCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Two writers can't both chain onto the same entry. Entries written
+		// before the chain existed have no seq and are left out.
+		{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"seq": bson.M{"$gt": 0}})},
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actorid", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "targettype", Value: 1}, {Key: "targetid", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	if err != nil {
+		log.Print("failed to create audit log indexes: ", err)
+	}
+	return repo
+}
+
+func (auRepo *AuditRepository) AppendAuditEntry(entry Domain.AuditEntry) error {
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		var last Domain.AuditEntry
+		findOptions := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+		err = auRepo.AuditCollection.FindOne(context.TODO(), bson.M{}, findOptions).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+		entry.Hash = entry.ChainHash()
+		_, err = auRepo.AuditCollection.InsertOne(context.TODO(), entry)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// FindAuditEntries returns a page of entries, newest first
+func (auRepo *AuditRepository) FindAuditEntries(filter Domain.AuditFilter) ([]Domain.AuditEntry, error) {
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := auRepo.AuditCollection.Find(context.TODO(), auditQuery(filter), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	entries := []Domain.AuditEntry{}
+	if err := cursor.All(context.TODO(), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (auRepo *AuditRepository) StreamAuditEntries(filter Domain.AuditFilter, fn func(Domain.AuditEntry) error) error {
+	findOptions := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := auRepo.AuditCollection.Find(context.TODO(), auditQuery(filter), findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var entry Domain.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (auRepo *AuditRepository) EraseActorDetails(actorID string) error {
+	update := bson.M{"$set": bson.M{"ip": "", "useragent": ""}}
+	_, err := auRepo.AuditCollection.UpdateMany(context.TODO(), bson.M{"actorid": actorID}, update)
+	return err
+}
+
+func auditQuery(filter Domain.AuditFilter) bson.M {
+	query := bson.M{}
+	if filter.ActorID != "" {
+		query["actorid"] = filter.ActorID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.TargetType != "" {
+		query["targettype"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		query["targetid"] = filter.TargetID
+	}
+	period := bson.M{}
+	if !filter.From.IsZero() {
+		period["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		period["$lt"] = filter.To
+	}
+	if len(period) > 0 {
+		query["time"] = period
+	}
+	return query
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	// "log"
 
@@ -14,28 +16,40 @@ import (
 )
 
 type BlogRepository struct {
-	BlogCollection      *mongo.Collection
-	LikesCollection     *mongo.Collection
-	ReadLaterCollection *mongo.Collection
+	BlogCollection       *mongo.Collection
+	LikesCollection      *mongo.Collection
+	ReadLaterCollection  *mongo.Collection
+	ReviewCollection     *mongo.Collection
+	TransitionCollection *mongo.Collection
 }
 
 type LikeTrackerDTO struct {
-	BlogID    string `bson:"id"`
-	UserEmail string `bson:"email"`
-	Liked     int    `bson:"liked"`
+	BlogID string `bson:"id"`
+	UserID string `bson:"userid"`
+	Liked  int    `bson:"liked"`
 }
 
 func NewBlogRepository(db *mongo.Database) *BlogRepository {
 	return &BlogRepository{
-		BlogCollection:      db.Collection("blogs"),
-		LikesCollection:     db.Collection("likes"),
-		ReadLaterCollection: db.Collection("read_later"),
+		BlogCollection:       db.Collection("blogs"),
+		LikesCollection:      db.Collection("likes"),
+		ReadLaterCollection:  db.Collection("read_later"),
+		ReviewCollection:     db.Collection("review_comments"),
+		TransitionCollection: db.Collection("blog_transitions"),
 	}
 }
 
-func (BlgRepo *BlogRepository) FindLiked(user_email, blog_id string) (*Domain.LikeTracker, error) {
+// withPublished limits a query to blogs readers can see. Blogs created
+// before the review workflow have no status and stay public.
+func withPublished(filter bson.M) bson.M {
+	filter["status"] = bson.M{"$in": bson.A{Domain.StatusPublished, nil}}
+	filter["deletedat"] = nil
+	return filter
+}
+
+func (BlgRepo *BlogRepository) FindLiked(userID, blog_id string) (*Domain.LikeTracker, error) {
 	var tmp LikeTrackerDTO
-	filter := bson.M{"id": blog_id, "email": user_email}
+	filter := bson.M{"id": blog_id, "userid": userID}
 	err := BlgRepo.LikesCollection.FindOne(context.TODO(), filter).Decode(&tmp)
 	return ChangeToDomain(&tmp), err
 }
@@ -46,7 +60,7 @@ func (BlgRepo *BlogRepository) CreateLikeTk(lt Domain.LikeTracker) error {
 }
 
 func (BlgRepo *BlogRepository) DeleteLikeTk(lt Domain.LikeTracker) error {
-	_, err := BlgRepo.LikesCollection.DeleteMany(context.TODO(), bson.M{"email": lt.UserEmail, "id": lt.BlogID})
+	_, err := BlgRepo.LikesCollection.DeleteMany(context.TODO(), bson.M{"userid": lt.UserID, "id": lt.BlogID})
 	return err
 }
 
@@ -72,16 +86,15 @@ func (BlgRepo *BlogRepository) SearchBlog(searchBlog *Domain.Blog) ([]Domain.Blo
 	if searchBlog.Title != "" {
 		filters["title"] = searchBlog.Title
 	}
-	if searchBlog.Owner_email != "" {
-		filters["owner_email"] = searchBlog.Owner_email
+	if searchBlog.OwnerID != "" {
+		filters["ownerid"] = searchBlog.OwnerID
 	}
 
 	// If no filters, return empty slice instead of querying everything
 	if len(filters) == 0 {
 		return []Domain.Blog{}, nil
 	}
-
-	cursor, err := BlgRepo.BlogCollection.Find(context.TODO(), filters)
+	cursor, err := BlgRepo.BlogCollection.Find(context.TODO(), withPublished(filters))
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +130,7 @@ func (BlgRepo *BlogRepository) UpdateBlog(updatedBlog *Domain.Blog) error {
 	if updatedBlog.Tags != nil {
 		updatedBSON["tags"] = updatedBlog.Tags
 	}
-	updatedBSON["viewcount"] = updatedBlog.ViewCount
-	updatedBSON["comments"] = updatedBlog.Comments
+	updatedBSON["revision"] = updatedBlog.Revision
 	update := bson.M{"$set": updatedBSON}
 	// Do update operation in database
 	updatedRes, err := BlgRepo.BlogCollection.UpdateOne(context.TODO(), filter, update)
@@ -138,7 +150,7 @@ func (BlgRepo *BlogRepository) GetAllBlogs(limit int, offset int) ([]Domain.Blog
 	findOptions.SetLimit(int64(limit))
 	findOptions.SetSkip(int64(offset))
 
-	result, err := BlgRepo.BlogCollection.Find(context.TODO(), bson.D{}, findOptions)
+	result, err := BlgRepo.BlogCollection.Find(context.TODO(), withPublished(bson.M{}), findOptions)
 
 	if err != nil {
 		return nil, err
@@ -158,18 +170,85 @@ func (BlgRepo *BlogRepository) GetAllBlogs(limit int, offset int) ([]Domain.Blog
 	return blogs, nil
 }
 
+// DeleteBlog moves a blog to its owner's trash
 func (BlgRepo *BlogRepository) DeleteBlog(ID string) error {
-	filter := bson.D{{Key: "id", Value: bson.D{{Key: "$eq", Value: ID}}}}
-	result, err := BlgRepo.BlogCollection.DeleteOne(context.TODO(), filter)
+	filter := bson.M{"id": ID, "deletedat": nil}
+	result, err := BlgRepo.BlogCollection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"deletedat": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("blog not found")
+	}
+	return nil
+}
+
+func (BlgRepo *BlogRepository) RestoreBlog(id string) error {
+	filter := bson.M{"id": id, "deletedat": bson.M{"$ne": nil}}
+	result, err := BlgRepo.BlogCollection.UpdateOne(context.TODO(), filter, bson.M{"$unset": bson.M{"deletedat": ""}})
 	if err != nil {
 		return err
 	}
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		return errors.New("blog not found")
 	}
 	return nil
 }
 
+func (BlgRepo *BlogRepository) GetTrashedBlog(id string) (Domain.Blog, error) {
+	var blog Domain.Blog
+	filter := bson.M{"id": id, "deletedat": bson.M{"$ne": nil}}
+	if err := BlgRepo.BlogCollection.FindOne(context.TODO(), filter).Decode(&blog); err != nil {
+		return blog, errors.New("blog not found")
+	}
+	return blog, nil
+}
+
+func (BlgRepo *BlogRepository) GetTrashedBlogs(ownerID string) ([]Domain.Blog, error) {
+	filter := bson.M{"ownerid": ownerID, "deletedat": bson.M{"$ne": nil}}
+	return BlgRepo.findBlogs(filter, options.Find().SetSort(bson.D{{Key: "deletedat", Value: -1}}))
+}
+
+func (BlgRepo *BlogRepository) GetTrashedBefore(date time.Time) ([]Domain.Blog, error) {
+	return BlgRepo.findBlogs(bson.M{"deletedat": bson.M{"$lt": date}}, options.Find())
+}
+
+// PurgeBlog permanently removes a blog and everything that points to it
+func (BlgRepo *BlogRepository) PurgeBlog(id string) error {
+	if _, err := BlgRepo.LikesCollection.DeleteMany(context.TODO(), bson.M{"id": id}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.ReadLaterCollection.DeleteMany(context.TODO(), bson.M{"blogids": id}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.ReviewCollection.DeleteMany(context.TODO(), bson.M{"blogid": id}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.TransitionCollection.DeleteMany(context.TODO(), bson.M{"blogid": id}); err != nil {
+		return err
+	}
+	_, err := BlgRepo.BlogCollection.DeleteOne(context.TODO(), bson.M{"id": id})
+	return err
+}
+
+func (BlgRepo *BlogRepository) findBlogs(filter bson.M, findOptions *options.FindOptions) ([]Domain.Blog, error) {
+	cursor, err := BlgRepo.BlogCollection.Find(context.TODO(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	blogs := []Domain.Blog{}
+	for cursor.Next(context.TODO()) {
+		var blog Domain.Blog
+		if err := cursor.Decode(&blog); err != nil {
+			return nil, fmt.Errorf("failed to decode blog: %w", err)
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, cursor.Err()
+}
+
 func (BlgRepo *BlogRepository) FilterBlog(filterBlog *Domain.Blog) ([]Domain.Blog, error) {
 	blogs := []Domain.Blog{}
 	filters := []bson.D{}
@@ -185,7 +264,7 @@ func (BlgRepo *BlogRepository) FilterBlog(filterBlog *Domain.Blog) ([]Domain.Blo
 		return nil, errors.New("at least one filter (date or tags) must be provided")
 	}
 
-	filter := bson.M{"$or": filters}
+	filter := withPublished(bson.M{"$or": filters})
 	cursor, err := BlgRepo.BlogCollection.Find(context.TODO(), filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find blogs: %w", err)
@@ -209,7 +288,7 @@ func (BlgRepo *BlogRepository) FilterBlog(filterBlog *Domain.Blog) ([]Domain.Blo
 
 func (BlgRepo *BlogRepository) GetBlog(id string) (Domain.Blog, error) {
 	var blog Domain.Blog
-	filter := bson.D{{Key: "id", Value: id}}
+	filter := bson.M{"id": id, "deletedat": nil}
 	err := BlgRepo.BlogCollection.FindOne(context.TODO(), filter).Decode(&blog)
 	if err != nil {
 		return blog, errors.New("Document with id " + id + " not found")
@@ -217,8 +296,18 @@ func (BlgRepo *BlogRepository) GetBlog(id string) (Domain.Blog, error) {
 	return blog, nil
 }
 
-func (BlgRepo *BlogRepository) GetLiked(email string) ([]string, error) {
-	filter := bson.D{{Key: "email", Value: email}}
+// GetPublishedBlog only finds blogs readers can see
+func (BlgRepo *BlogRepository) GetPublishedBlog(id string) (Domain.Blog, error) {
+	var blog Domain.Blog
+	err := BlgRepo.BlogCollection.FindOne(context.TODO(), withPublished(bson.M{"id": id})).Decode(&blog)
+	if err != nil {
+		return blog, errors.New("Document with id " + id + " not found")
+	}
+	return blog, nil
+}
+
+func (BlgRepo *BlogRepository) GetLiked(userID string) ([]string, error) {
+	filter := bson.D{{Key: "userid", Value: userID}}
 	cursor, err := BlgRepo.LikesCollection.Find(context.TODO(), filter)
 	if err != nil {
 		return []string{}, err
@@ -240,17 +329,17 @@ func (BlgRepo *BlogRepository) GetLiked(email string) ([]string, error) {
 
 func ChangeToDTO(t Domain.LikeTracker) LikeTrackerDTO {
 	return LikeTrackerDTO{
-		BlogID:    t.BlogID,
-		UserEmail: t.UserEmail,
-		Liked:     t.Liked,
+		BlogID: t.BlogID,
+		UserID: t.UserID,
+		Liked:  t.Liked,
 	}
 }
 
 func ChangeToDomain(t *LikeTrackerDTO) *Domain.LikeTracker {
 	return &Domain.LikeTracker{
-		BlogID:    t.BlogID,
-		UserEmail: t.UserEmail,
-		Liked:     t.Liked,
+		BlogID: t.BlogID,
+		UserID: t.UserID,
+		Liked:  t.Liked,
 	}
 }
 
@@ -259,8 +348,8 @@ func (BlgRepo *BlogRepository) StoreReadLaterBlog(blog Domain.ReadLater) error {
 	return err
 }
 
-func (BlgRepo *BlogRepository) FetchReadLaterBlog(email string) ([]string, error) {
-	result, err := BlgRepo.ReadLaterCollection.Find(context.TODO(), bson.M{"useremail": email})
+func (BlgRepo *BlogRepository) FetchReadLaterBlog(userID string) ([]string, error) {
+	result, err := BlgRepo.ReadLaterCollection.Find(context.TODO(), bson.M{"userid": userID})
 	if err != nil {
 		return nil, err
 	}
@@ -276,3 +365,193 @@ func (BlgRepo *BlogRepository) FetchReadLaterBlog(email string) ([]string, error
 	}
 	return blogs, nil
 }
+
+func (BlgRepo *BlogRepository) UpdateBlogStatus(id, status string) error {
+	return BlgRepo.updateLive(id, bson.M{"$set": bson.M{"status": status}})
+}
+
+func (BlgRepo *BlogRepository) GetBlogsByStatus(status string) ([]Domain.Blog, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	return BlgRepo.findBlogs(bson.M{"status": status, "deletedat": nil}, findOptions)
+}
+
+func (BlgRepo *BlogRepository) StoreTransition(tr Domain.ReviewTransition) error {
+	_, err := BlgRepo.TransitionCollection.InsertOne(context.TODO(), tr)
+	return err
+}
+
+func (BlgRepo *BlogRepository) GetTransitions(blogID string) ([]Domain.ReviewTransition, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := BlgRepo.TransitionCollection.Find(context.TODO(), bson.M{"blogid": blogID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	transitions := []Domain.ReviewTransition{}
+	if err := cursor.All(context.TODO(), &transitions); err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+func (BlgRepo *BlogRepository) StoreReviewComment(comment Domain.ReviewComment) error {
+	_, err := BlgRepo.ReviewCollection.InsertOne(context.TODO(), comment)
+	return err
+}
+
+func (BlgRepo *BlogRepository) GetReviewComments(blogID string) ([]Domain.ReviewComment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := BlgRepo.ReviewCollection.Find(context.TODO(), bson.M{"blogid": blogID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	comments := []Domain.ReviewComment{}
+	if err := cursor.All(context.TODO(), &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (BlgRepo *BlogRepository) ReferencesMedia(id, url string) (bool, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"content": bson.M{"$regex": regexp.QuoteMeta(url)}},
+		bson.M{"coverimage.mediaid": id},
+	}}
+	count, err := BlgRepo.BlogCollection.CountDocuments(context.TODO(), filter)
+	return count > 0, err
+}
+
+func (BlgRepo *BlogRepository) UpdateBlogCover(id string, cover *Domain.Image) error {
+	return BlgRepo.updateLive(id, bson.M{"$set": bson.M{"coverimage": cover}})
+}
+
+func (BlgRepo *BlogRepository) RefreshCoverImage(cover Domain.Image) error {
+	filter := bson.M{"coverimage.mediaid": cover.MediaID}
+	_, err := BlgRepo.BlogCollection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"coverimage": cover}})
+	return err
+}
+
+func (BlgRepo *BlogRepository) IncrementViewCount(id string) error {
+	return BlgRepo.updateMatching(withPublished(bson.M{"id": id}), bson.M{"$inc": bson.M{"viewcount": 1}})
+}
+
+func (BlgRepo *BlogRepository) AddComment(id string, comment Domain.Comment) error {
+	return BlgRepo.updateMatching(withPublished(bson.M{"id": id}), bson.M{"$push": bson.M{"comments": comment}})
+}
+
+// GetCommentsBy finds the user's comments on every blog, drafts and trash included
+func (BlgRepo *BlogRepository) GetCommentsBy(authorID string) ([]Domain.BlogComment, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"comments.authorid": authorID}}},
+		{{Key: "$unwind", Value: "$comments"}},
+		{{Key: "$match", Value: bson.M{"comments.authorid": authorID}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "blogid": "$id", "comment": "$comments"}}},
+		{{Key: "$sort", Value: bson.M{"comment.date": 1}}},
+	}
+	cursor, err := BlgRepo.BlogCollection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	comments := []Domain.BlogComment{}
+	if err := cursor.All(context.TODO(), &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (BlgRepo *BlogRepository) DeleteCommentsBy(authorID string) error {
+	update := bson.M{"$pull": bson.M{"comments": bson.M{"authorid": authorID}}}
+	_, err := BlgRepo.BlogCollection.UpdateMany(context.TODO(), bson.M{"comments.authorid": authorID}, update)
+	return err
+}
+
+func (BlgRepo *BlogRepository) ReassignComments(fromID, toID string) error {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"comment.authorid": fromID}}})
+	update := bson.M{"$set": bson.M{"comments.$[comment].authorid": toID}}
+	_, err := BlgRepo.BlogCollection.UpdateMany(context.TODO(), bson.M{"comments.authorid": fromID}, update, opts)
+	return err
+}
+
+func (BlgRepo *BlogRepository) UpdateCoAuthors(id string, coAuthors []string) error {
+	return BlgRepo.updateLive(id, bson.M{"$set": bson.M{"coauthors": coAuthors}})
+}
+
+// updateLive applies an update to a blog that is not in the trash
+func (BlgRepo *BlogRepository) updateLive(id string, update bson.M) error {
+	return BlgRepo.updateMatching(bson.M{"id": id, "deletedat": nil}, update)
+}
+
+func (BlgRepo *BlogRepository) updateMatching(filter, update bson.M) error {
+	result, err := BlgRepo.BlogCollection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("blog not found")
+	}
+	return nil
+}
+
+func (BlgRepo *BlogRepository) GetBlogsByOwner(ownerID string) ([]Domain.Blog, error) {
+	return BlgRepo.findBlogs(bson.M{"ownerid": ownerID}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+}
+
+func (BlgRepo *BlogRepository) GetReactions(userID string) ([]Domain.LikeTracker, error) {
+	cursor, err := BlgRepo.LikesCollection.Find(context.TODO(), bson.M{"userid": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	reactions := []Domain.LikeTracker{}
+	for cursor.Next(context.TODO()) {
+		var like LikeTrackerDTO
+		if err := cursor.Decode(&like); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, *ChangeToDomain(&like))
+	}
+	return reactions, cursor.Err()
+}
+
+func (BlgRepo *BlogRepository) GetReviewCommentsBy(reviewerID string) ([]Domain.ReviewComment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := BlgRepo.ReviewCollection.Find(context.TODO(), bson.M{"reviewerid": reviewerID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	comments := []Domain.ReviewComment{}
+	if err := cursor.All(context.TODO(), &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (BlgRepo *BlogRepository) ReassignBlogs(fromID, toID string) error {
+	_, err := BlgRepo.BlogCollection.UpdateMany(context.TODO(), bson.M{"ownerid": fromID}, bson.M{"$set": bson.M{"ownerid": toID}})
+	return err
+}
+
+func (BlgRepo *BlogRepository) ForgetUser(userID, replacementID string) error {
+	if _, err := BlgRepo.LikesCollection.DeleteMany(context.TODO(), bson.M{"userid": userID}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.ReadLaterCollection.DeleteMany(context.TODO(), bson.M{"userid": userID}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.BlogCollection.UpdateMany(context.TODO(), bson.M{"coauthors": userID}, bson.M{"$pull": bson.M{"coauthors": userID}}); err != nil {
+		return err
+	}
+	if _, err := BlgRepo.ReviewCollection.UpdateMany(context.TODO(), bson.M{"reviewerid": userID}, bson.M{"$set": bson.M{"reviewerid": replacementID}}); err != nil {
+		return err
+	}
+	_, err := BlgRepo.TransitionCollection.UpdateMany(context.TODO(), bson.M{"actorid": userID}, bson.M{"$set": bson.M{"actorid": replacementID}})
+	return err
+}
@@ -0,0 +1,61 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EmailChangeRepository struct {
+	ChangeCollection *mongo.Collection
+}
+
+func NewEmailChangeRepository(db *mongo.Database) *EmailChangeRepository {
+	repo := &EmailChangeRepository{
+		ChangeCollection: db.Collection("email_changes"),
+	}
+	// Unconfirmed changes are dropped once their links expire
+	_, err := repo.ChangeCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "oldtokenhash", Value: 1}}},
+		{Keys: bson.D{{Key: "newtokenhash", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create email change indexes: ", err)
+	}
+	return repo
+}
+
+func (ecRepo *EmailChangeRepository) StoreEmailChange(change Domain.EmailChange) error {
+	_, err := ecRepo.ChangeCollection.ReplaceOne(context.TODO(), bson.M{"email": change.Email}, change, options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetEmailChange finds the change either of its links belongs to
+func (ecRepo *EmailChangeRepository) GetEmailChange(tokenHash string) (Domain.EmailChange, error) {
+	var change Domain.EmailChange
+	filter := bson.M{"$or": bson.A{bson.M{"oldtokenhash": tokenHash}, bson.M{"newtokenhash": tokenHash}}}
+	err := ecRepo.ChangeCollection.FindOne(context.TODO(), filter).Decode(&change)
+	return change, err
+}
+
+func (ecRepo *EmailChangeRepository) ConfirmEmailChange(id string, oldAddress bool) (Domain.EmailChange, error) {
+	var change Domain.EmailChange
+	field := "newconfirmed"
+	if oldAddress {
+		field = "oldconfirmed"
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := ecRepo.ChangeCollection.FindOneAndUpdate(context.TODO(), bson.M{"id": id}, bson.M{"$set": bson.M{field: true}}, opts).Decode(&change)
+	return change, err
+}
+
+func (ecRepo *EmailChangeRepository) DeleteEmailChange(email string) error {
+	_, err := ecRepo.ChangeCollection.DeleteMany(context.TODO(), bson.M{"email": email})
+	return err
+}
@@ -0,0 +1,59 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoginAttemptRepository struct {
+	AttemptsCollection *mongo.Collection
+}
+
+func NewLoginAttemptRepository(db *mongo.Database) *LoginAttemptRepository {
+	repo := &LoginAttemptRepository{
+		AttemptsCollection: db.Collection("login_attempts"),
+	}
+	// Counters nobody failed on for a day are of no use anymore
+	_, err := repo.AttemptsCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "lastfailure", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds()))},
+	})
+	if err != nil {
+		log.Print("failed to create login attempt indexes: ", err)
+	}
+	return repo
+}
+
+func (laRepo *LoginAttemptRepository) GetAttempts(key string) (Domain.LoginAttempts, error) {
+	var attempts Domain.LoginAttempts
+	err := laRepo.AttemptsCollection.FindOne(context.TODO(), bson.M{"key": key}).Decode(&attempts)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Domain.LoginAttempts{Key: key}, nil
+	}
+	return attempts, err
+}
+
+func (laRepo *LoginAttemptRepository) RecordFailure(key string, at time.Time) (Domain.LoginAttempts, error) {
+	var attempts Domain.LoginAttempts
+	update := bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"lastfailure": at}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := laRepo.AttemptsCollection.FindOneAndUpdate(context.TODO(), bson.M{"key": key}, update, opts).Decode(&attempts)
+	return attempts, err
+}
+
+func (laRepo *LoginAttemptRepository) Lock(key string, until time.Time) error {
+	_, err := laRepo.AttemptsCollection.UpdateOne(context.TODO(), bson.M{"key": key}, bson.M{"$set": bson.M{"lockeduntil": until, "failures": 0}})
+	return err
+}
+
+func (laRepo *LoginAttemptRepository) Reset(key string) error {
+	_, err := laRepo.AttemptsCollection.DeleteOne(context.TODO(), bson.M{"key": key})
+	return err
+}
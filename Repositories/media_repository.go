@@ -0,0 +1,67 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MediaRepository struct {
+	MediaCollection *mongo.Collection
+}
+
+func NewMediaRepository(db *mongo.Database) *MediaRepository {
+	return &MediaRepository{
+		MediaCollection: db.Collection("media"),
+	}
+}
+
+func (mRepo *MediaRepository) StoreMedia(media Domain.Media) error {
+	_, err := mRepo.MediaCollection.InsertOne(context.TODO(), media)
+	return err
+}
+
+func (mRepo *MediaRepository) GetMedia(id string) (Domain.Media, error) {
+	var media Domain.Media
+	err := mRepo.MediaCollection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&media)
+	if err != nil {
+		return media, errors.New("media not found")
+	}
+	return media, nil
+}
+
+func (mRepo *MediaRepository) GetUserMedia(ownerID string) ([]Domain.Media, error) {
+	return mRepo.find(bson.M{"ownerid": ownerID})
+}
+
+func (mRepo *MediaRepository) GetMediaBefore(date time.Time) ([]Domain.Media, error) {
+	return mRepo.find(bson.M{"date": bson.M{"$lt": date}})
+}
+
+func (mRepo *MediaRepository) DeleteMedia(id string) error {
+	_, err := mRepo.MediaCollection.DeleteOne(context.TODO(), bson.M{"id": id})
+	return err
+}
+
+func (mRepo *MediaRepository) UpdateMedia(media Domain.Media) error {
+	_, err := mRepo.MediaCollection.ReplaceOne(context.TODO(), bson.M{"id": media.ID}, media)
+	return err
+}
+
+func (mRepo *MediaRepository) find(filter bson.M) ([]Domain.Media, error) {
+	cursor, err := mRepo.MediaCollection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	media := []Domain.Media{}
+	if err := cursor.All(context.TODO(), &media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
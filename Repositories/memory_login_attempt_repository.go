@@ -0,0 +1,75 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"sync"
+	"time"
+)
+
+// MemoryLoginAttemptRepository keeps login attempts in process. It suits a
+// single instance and tests, counters are not shared between instances.
+type MemoryLoginAttemptRepository struct {
+	mu        sync.Mutex
+	attempts  map[string]Domain.LoginAttempts
+	lastSweep time.Time
+}
+
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{
+		attempts:  make(map[string]Domain.LoginAttempts),
+		lastSweep: time.Now(),
+	}
+}
+
+func (laRepo *MemoryLoginAttemptRepository) GetAttempts(key string) (Domain.LoginAttempts, error) {
+	laRepo.mu.Lock()
+	defer laRepo.mu.Unlock()
+	if attempts, ok := laRepo.attempts[key]; ok {
+		return attempts, nil
+	}
+	return Domain.LoginAttempts{Key: key}, nil
+}
+
+func (laRepo *MemoryLoginAttemptRepository) RecordFailure(key string, at time.Time) (Domain.LoginAttempts, error) {
+	laRepo.mu.Lock()
+	defer laRepo.mu.Unlock()
+	laRepo.sweep(at)
+	attempts := laRepo.attempts[key]
+	attempts.Key = key
+	attempts.Failures++
+	attempts.LastFailure = at
+	laRepo.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (laRepo *MemoryLoginAttemptRepository) Lock(key string, until time.Time) error {
+	laRepo.mu.Lock()
+	defer laRepo.mu.Unlock()
+	if attempts, ok := laRepo.attempts[key]; ok {
+		attempts.LockedUntil = until
+		attempts.Failures = 0
+		laRepo.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (laRepo *MemoryLoginAttemptRepository) Reset(key string) error {
+	laRepo.mu.Lock()
+	defer laRepo.mu.Unlock()
+	delete(laRepo.attempts, key)
+	return nil
+}
+
+// sweep drops counters nobody failed on for a day, at most once a minute.
+// Callers must hold mu.
+func (laRepo *MemoryLoginAttemptRepository) sweep(now time.Time) {
+	if now.Sub(laRepo.lastSweep) < time.Minute {
+		return
+	}
+	for key, attempts := range laRepo.attempts {
+		if now.Sub(attempts.LastFailure) > 24*time.Hour && now.After(attempts.LockedUntil) {
+			delete(laRepo.attempts, key)
+		}
+	}
+	laRepo.lastSweep = now
+}
@@ -0,0 +1,62 @@
+package Repositories
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryRateLimitRepository counts requests in process, every instance of
+// the API then enforces its own limits
+type MemoryRateLimitRepository struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+}
+
+type memoryWindow struct {
+	start    time.Time
+	current  int64
+	previous int64
+	// window is kept to know when the counts have become useless
+	window time.Duration
+}
+
+func NewMemoryRateLimitRepository() *MemoryRateLimitRepository {
+	return &MemoryRateLimitRepository{
+		windows:   make(map[string]*memoryWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+func (rlRepo *MemoryRateLimitRepository) Hit(key string, start time.Time, window time.Duration) (int64, int64, error) {
+	rlRepo.mu.Lock()
+	defer rlRepo.mu.Unlock()
+	rlRepo.sweep(time.Now())
+	w, ok := rlRepo.windows[key]
+	switch {
+	case !ok:
+		w = &memoryWindow{start: start, window: window}
+		rlRepo.windows[key] = w
+	case w.start.Equal(start.Add(-window)):
+		// The window moved on by one, the old count becomes the previous one
+		w.start, w.previous, w.current = start, w.current, 0
+	case !w.start.Equal(start):
+		w.start, w.previous, w.current = start, 0, 0
+	}
+	w.current++
+	return w.current, w.previous, nil
+}
+
+// sweep drops keys that were not hit for two windows, at most once a minute.
+// Callers must hold mu.
+func (rlRepo *MemoryRateLimitRepository) sweep(now time.Time) {
+	if now.Sub(rlRepo.lastSweep) < time.Minute {
+		return
+	}
+	for key, w := range rlRepo.windows {
+		if now.Sub(w.start) >= 2*w.window {
+			delete(rlRepo.windows, key)
+		}
+	}
+	rlRepo.lastSweep = now
+}
@@ -0,0 +1,76 @@
+package Repositories
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitRepositoryHit(t *testing.T) {
+	const window = time.Minute
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	type hit struct {
+		key               string
+		start             time.Time
+		current, previous int64
+	}
+	tests := []struct {
+		name string
+		hits []hit
+	}{
+		{"counts within a window", []hit{
+			{"a", start, 1, 0},
+			{"a", start, 2, 0},
+			{"a", start, 3, 0},
+		}},
+		{"next window takes over the count", []hit{
+			{"a", start, 1, 0},
+			{"a", start, 2, 0},
+			{"a", start.Add(window), 1, 2},
+			{"a", start.Add(window), 2, 2},
+			{"a", start.Add(2 * window), 1, 2},
+		}},
+		{"skipped window forgets both", []hit{
+			{"a", start, 1, 0},
+			{"a", start, 2, 0},
+			{"a", start.Add(2 * window), 1, 0},
+		}},
+		{"earlier window starts over", []hit{
+			{"a", start, 1, 0},
+			{"a", start.Add(-window), 1, 0},
+		}},
+		{"keys count apart", []hit{
+			{"a", start, 1, 0},
+			{"b", start, 1, 0},
+			{"a", start, 2, 0},
+			{"b", start.Add(window), 1, 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMemoryRateLimitRepository()
+			for i, h := range tt.hits {
+				current, previous, err := repo.Hit(h.key, h.start, window)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if current != h.current || previous != h.previous {
+					t.Errorf("hit %d on %s: got (%d, %d), want (%d, %d)", i, h.key, current, previous, h.current, h.previous)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitRepositorySweep(t *testing.T) {
+	repo := NewMemoryRateLimitRepository()
+	now := time.Now()
+	repo.Hit("old", now.Truncate(time.Minute).Add(-3*time.Minute), time.Minute)
+	repo.Hit("recent", now.Truncate(time.Minute), time.Minute)
+	repo.sweep(now.Add(time.Minute))
+	if _, ok := repo.windows["old"]; ok {
+		t.Error("window not hit for two windows was kept")
+	}
+	if _, ok := repo.windows["recent"]; !ok {
+		t.Error("recent window was swept")
+	}
+}
@@ -0,0 +1,138 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userReferences are the fields that pointed at users by email before users had an ID
+var userReferences = []struct {
+	collection string
+	from       string
+	to         string
+}{
+	{"blogs", "owner_email", "ownerid"},
+	{"likes", "email", "userid"},
+	{"read_later", "useremail", "userid"},
+	{"review_comments", "revieweremail", "reviewerid"},
+	{"blog_transitions", "actoremail", "actorid"},
+	{"media", "owneremail", "ownerid"},
+	{"sessions", "email", "userid"},
+	{"refresh_tokens", "email", "userid"},
+	{"access_tokens", "email", "userid"},
+	{"oauth_clients", "owneremail", "ownerid"},
+	{"oauth_codes", "email", "userid"},
+}
+
+// MigrateUserIDs gives every user an ID and moves documents that still point
+// at users by email over to that ID. Migrated data is left alone, so it is
+// safe to run on every start.
+func MigrateUserIDs(db *mongo.Database) error {
+	ids, err := assignUserIDs(db.Collection("users"))
+	if err != nil {
+		return err
+	}
+	for _, ref := range userReferences {
+		collection := db.Collection(ref.collection)
+		emails, err := collection.Distinct(context.TODO(), ref.from, bson.M{ref.from: bson.M{"$exists": true}})
+		if err != nil {
+			return err
+		}
+		for _, email := range emails {
+			email, _ := email.(string)
+			id, ok := ids[email]
+			if !ok {
+				// Nobody owns it anymore, there is nothing to point at
+				continue
+			}
+			update := bson.M{"$set": bson.M{ref.to: id}, "$unset": bson.M{ref.from: ""}}
+			if _, err := collection.UpdateMany(context.TODO(), bson.M{ref.from: email}, update); err != nil {
+				return err
+			}
+		}
+	}
+	return migrateCoAuthors(db.Collection("blogs"), ids)
+}
+
+// assignUserIDs returns the ID of every user by email
+func assignUserIDs(users *mongo.Collection) (map[string]string, error) {
+	cursor, err := users.Find(context.TODO(), bson.M{}, options.Find().SetProjection(bson.M{"id": 1, "email": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	ids := map[string]string{}
+	for cursor.Next(context.TODO()) {
+		var user bson.M
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		email, _ := user["email"].(string)
+		id, _ := user["id"].(string)
+		if id == "" {
+			id = uuid.New().String()
+			if _, err := users.UpdateByID(context.TODO(), user["_id"], bson.M{"$set": bson.M{"id": id}}); err != nil {
+				return nil, err
+			}
+		}
+		ids[email] = id
+	}
+	return ids, cursor.Err()
+}
+
+// migrateCoAuthors swaps the emails in co-author lists for user IDs
+func migrateCoAuthors(blogs *mongo.Collection, ids map[string]string) error {
+	coAuthors, err := blogs.Distinct(context.TODO(), "coauthors", bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, coAuthor := range coAuthors {
+		email, _ := coAuthor.(string)
+		id, ok := ids[email]
+		if !ok {
+			continue
+		}
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"author": email}}})
+		if _, err := blogs.UpdateMany(context.TODO(), bson.M{"coauthors": email}, bson.M{"$set": bson.M{"coauthors.$[author]": id}}, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateComments turns comments stored as plain text into Comment documents.
+// Who wrote them and when was never recorded, so they keep neither.
+func MigrateComments(db *mongo.Database) error {
+	blogs := db.Collection("blogs")
+	findOptions := options.Find().SetProjection(bson.M{"comments": 1})
+	cursor, err := blogs.Find(context.TODO(), bson.M{"comments": bson.M{"$type": "string"}}, findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var blog bson.M
+		if err := cursor.Decode(&blog); err != nil {
+			return err
+		}
+		old, _ := blog["comments"].(bson.A)
+		comments := bson.A{}
+		for _, comment := range old {
+			if text, ok := comment.(string); ok {
+				comment = Domain.Comment{ID: uuid.New().String(), Text: text}
+			}
+			comments = append(comments, comment)
+		}
+		if _, err := blogs.UpdateByID(context.TODO(), blog["_id"], bson.M{"$set": bson.M{"comments": comments}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
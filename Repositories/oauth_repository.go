@@ -0,0 +1,91 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OAuthRepository struct {
+	ClientCollection *mongo.Collection
+	CodeCollection   *mongo.Collection
+}
+
+func NewOAuthRepository(db *mongo.Database) *OAuthRepository {
+	repo := &OAuthRepository{
+		ClientCollection: db.Collection("oauth_clients"),
+		CodeCollection:   db.Collection("oauth_codes"),
+	}
+	_, err := repo.ClientCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ownerid", Value: 1}}},
+	})
+	if err != nil {
+		log.Print("failed to create oauth client indexes: ", err)
+	}
+	_, err = repo.CodeCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "codehash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create oauth code indexes: ", err)
+	}
+	return repo
+}
+
+func (oaRepo *OAuthRepository) StoreClient(client Domain.OAuthClient) error {
+	_, err := oaRepo.ClientCollection.InsertOne(context.TODO(), client)
+	return err
+}
+
+func (oaRepo *OAuthRepository) GetClient(id string) (Domain.OAuthClient, error) {
+	var client Domain.OAuthClient
+	err := oaRepo.ClientCollection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&client)
+	if err != nil {
+		return client, errors.New("client not found")
+	}
+	return client, nil
+}
+
+func (oaRepo *OAuthRepository) GetClients(ownerID string) ([]Domain.OAuthClient, error) {
+	cursor, err := oaRepo.ClientCollection.Find(context.TODO(), bson.M{"ownerid": ownerID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	clients := []Domain.OAuthClient{}
+	if err := cursor.All(context.TODO(), &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (oaRepo *OAuthRepository) DeleteClient(id, ownerID string) error {
+	result, err := oaRepo.ClientCollection.DeleteOne(context.TODO(), bson.M{"id": id, "ownerid": ownerID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("client not found")
+	}
+	_, err = oaRepo.CodeCollection.DeleteMany(context.TODO(), bson.M{"clientid": id})
+	return err
+}
+
+func (oaRepo *OAuthRepository) StoreCode(code Domain.OAuthCode) error {
+	_, err := oaRepo.CodeCollection.InsertOne(context.TODO(), code)
+	return err
+}
+
+// ConsumeCode deletes the code as it reads it, so it can be exchanged only once
+func (oaRepo *OAuthRepository) ConsumeCode(codeHash string) (Domain.OAuthCode, error) {
+	var code Domain.OAuthCode
+	err := oaRepo.CodeCollection.FindOneAndDelete(context.TODO(), bson.M{"codehash": codeHash}).Decode(&code)
+	return code, err
+}
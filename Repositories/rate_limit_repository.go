@@ -0,0 +1,55 @@
+package Repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitRepository shares request counts between every instance of the API
+type RateLimitRepository struct {
+	WindowsCollection *mongo.Collection
+}
+
+type rateLimitWindow struct {
+	Key       string
+	Start     time.Time
+	Count     int64
+	ExpiresAt time.Time
+}
+
+func NewRateLimitRepository(db *mongo.Database) *RateLimitRepository {
+	repo := &RateLimitRepository{
+		WindowsCollection: db.Collection("rate_limits"),
+	}
+	// A window is only needed until the one after it has ended
+	_, err := repo.WindowsCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "start", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create rate limit indexes: ", err)
+	}
+	return repo
+}
+
+func (rlRepo *RateLimitRepository) Hit(key string, start time.Time, window time.Duration) (int64, int64, error) {
+	var current rateLimitWindow
+	update := bson.M{"$inc": bson.M{"count": 1}, "$setOnInsert": bson.M{"expiresat": start.Add(2 * window)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := rlRepo.WindowsCollection.FindOneAndUpdate(context.TODO(), bson.M{"key": key, "start": start}, update, opts).Decode(&current)
+	if err != nil {
+		return 0, 0, err
+	}
+	var previous rateLimitWindow
+	err = rlRepo.WindowsCollection.FindOne(context.TODO(), bson.M{"key": key, "start": start.Add(-window)}).Decode(&previous)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, 0, err
+	}
+	return current.Count, previous.Count, nil
+}
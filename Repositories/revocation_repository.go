@@ -0,0 +1,41 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevocationRepository struct {
+	RevokedCollection *mongo.Collection
+}
+
+func NewRevocationRepository(db *mongo.Database) *RevocationRepository {
+	repo := &RevocationRepository{
+		RevokedCollection: db.Collection("revoked_tokens"),
+	}
+	// An entry is useless once the token it blocks has expired
+	_, err := repo.RevokedCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create revoked token indexes: ", err)
+	}
+	return repo
+}
+
+func (rvRepo *RevocationRepository) Revoke(token Domain.RevokedToken) error {
+	update := bson.M{"$setOnInsert": token}
+	_, err := rvRepo.RevokedCollection.UpdateOne(context.TODO(), bson.M{"jti": token.JTI}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (rvRepo *RevocationRepository) IsRevoked(jti string) (bool, error) {
+	count, err := rvRepo.RevokedCollection.CountDocuments(context.TODO(), bson.M{"jti": jti})
+	return count > 0, err
+}
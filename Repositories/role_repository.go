@@ -0,0 +1,73 @@
+package Repositories
+
+import (
+	"blog_api/Domain"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RoleRepository struct {
+	RoleCollection *mongo.Collection
+	UserCollection *mongo.Collection
+}
+
+func NewRoleRepository(db *mongo.Database) *RoleRepository {
+	return &RoleRepository{
+		RoleCollection: db.Collection("roles"),
+		UserCollection: db.Collection("users"),
+	}
+}
+
+func (rRepo *RoleRepository) UpsertRole(role Domain.Role) error {
+	_, err := rRepo.RoleCollection.ReplaceOne(context.TODO(), bson.M{"name": role.Name}, role, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (rRepo *RoleRepository) InsertRoleIfMissing(role Domain.Role) error {
+	update := bson.M{"$setOnInsert": role}
+	_, err := rRepo.RoleCollection.UpdateOne(context.TODO(), bson.M{"name": role.Name}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (rRepo *RoleRepository) GetRole(name string) (Domain.Role, error) {
+	var role Domain.Role
+	err := rRepo.RoleCollection.FindOne(context.TODO(), bson.M{"name": name}).Decode(&role)
+	if err != nil {
+		return role, errors.New("role not found")
+	}
+	return role, nil
+}
+
+func (rRepo *RoleRepository) GetRoles() ([]Domain.Role, error) {
+	cursor, err := rRepo.RoleCollection.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	roles := []Domain.Role{}
+	if err := cursor.All(context.TODO(), &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (rRepo *RoleRepository) DeleteRole(name string) error {
+	result, err := rRepo.RoleCollection.DeleteOne(context.TODO(), bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("role not found")
+	}
+	return nil
+}
+
+func (rRepo *RoleRepository) CountUsersWithRole(name string) (int64, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"roles": name}, bson.M{"role": name}}}
+	return rRepo.UserCollection.CountDocuments(context.TODO(), filter)
+}
@@ -3,34 +3,105 @@ package Repositories
 import (
 	"blog_api/Domain"
 	"context"
+	"errors"
+	"log"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository struct {
 	UserCollection   *mongo.Collection
 	ResetPassword    *mongo.Collection
 	TokensCollection *mongo.Collection
-	BlackList        *mongo.Collection
+	Sessions         *mongo.Collection
+	MagicLinks       *mongo.Collection
 }
 
 func NewUserRepository(db *mongo.Database) *UserRepository {
-	return &UserRepository{
+	repo := &UserRepository{
 		UserCollection:   db.Collection("users"),
 		ResetPassword:    db.Collection("pass_reset"),
 		TokensCollection: db.Collection("refresh_tokens"),
-		BlackList:        db.Collection("blacklist"),
+		Sessions:         db.Collection("sessions"),
+		MagicLinks:       db.Collection("magic_links"),
 	}
+	// Let mongo drop refresh tokens once they expire
+	_, err := repo.TokensCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "familyid", Value: 1}}},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create refresh token indexes: ", err)
+	}
+	// A session is dead once its last refresh token could have expired
+	_, err = repo.Sessions.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+		{Keys: bson.D{{Key: "lastusedat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds()))},
+	})
+	if err != nil {
+		log.Print("failed to create session indexes: ", err)
+	}
+	_, err = repo.MagicLinks.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdat", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create magic link indexes: ", err)
+	}
+	_, err = repo.UserCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		// Registration and email changes check for a taken address before
+		// writing, this catches the ones that race past the check
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "createdat", Value: -1}}},
+	})
+	if err != nil {
+		log.Print("failed to create user indexes: ", err)
+	}
+	_, err = repo.ResetPassword.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Print("failed to create password reset indexes: ", err)
+	}
+	// Reset tokens used to be stored in plain text, they can't be trusted anymore.
+	// Tokens and links that only name an address could reach whoever holds it now.
+	_, err = repo.ResetPassword.DeleteMany(context.TODO(), bson.M{"$or": bson.A{
+		bson.M{"tokenhash": bson.M{"$exists": false}},
+		bson.M{"userid": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		log.Print("failed to remove old reset tokens: ", err)
+	}
+	_, err = repo.MagicLinks.DeleteMany(context.TODO(), bson.M{"userid": bson.M{"$exists": false}})
+	if err != nil {
+		log.Print("failed to remove old magic links: ", err)
+	}
+	// Accounts verified before the flag was fixed were stored as "verified"
+	_, err = repo.UserCollection.UpdateMany(context.TODO(), bson.M{"verified": true}, bson.M{"$set": bson.M{"verfied": true}, "$unset": bson.M{"verified": ""}})
+	if err != nil {
+		log.Print("failed to migrate verified users: ", err)
+	}
+	return repo
 }
 
-func (usRepo *UserRepository) UpdatePassword(email, password string) error {
-	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": email}, bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: password}}}})
+func (usRepo *UserRepository) UpdatePassword(id, password string, history []string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: password}, {Key: "passwordhistory", Value: history}}}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, update)
 	return err
 }
 
-func (usRepo *UserRepository) ForgotPassword(data Domain.ResetTokenS) error {
-	_, err := usRepo.ResetPassword.InsertOne(context.TODO(), data)
+func (usRepo *UserRepository) StoreResetToken(token Domain.ResetTokenS) error {
+	_, err := usRepo.ResetPassword.ReplaceOne(context.TODO(), bson.M{"userid": token.UserID}, token, options.Replace().SetUpsert(true))
 	return err
 }
 
@@ -45,10 +116,18 @@ func (usRepo *UserRepository) GetUser(user *Domain.User) (*Domain.User, error) {
 	return &existingUser, err
 }
 
-func (usRepo *UserRepository) GetTokenData(email string) (Domain.ResetTokenS, error) {
-	var data Domain.ResetTokenS
-	err := usRepo.ResetPassword.FindOne(context.TODO(), bson.M{"email": email}).Decode(&data)
-	return data, err
+func (usRepo *UserRepository) GetResetToken(tokenHash string) (Domain.ResetTokenS, error) {
+	var token Domain.ResetTokenS
+	err := usRepo.ResetPassword.FindOne(context.TODO(), bson.M{"tokenhash": tokenHash}).Decode(&token)
+	return token, err
+}
+
+func (usRepo *UserRepository) ConsumeResetToken(tokenHash string) (bool, error) {
+	result, err := usRepo.ResetPassword.DeleteOne(context.TODO(), bson.M{"tokenhash": tokenHash})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
 }
 
 func (usRepo *UserRepository) DeleteTokenData(email string) error {
@@ -56,20 +135,107 @@ func (usRepo *UserRepository) DeleteTokenData(email string) error {
 	return err
 }
 
-func (usRepo *UserRepository) UpdateUser(user *Domain.User) error {
-	updateFields := bson.M{"verified": true}
-	updateBSON := bson.D{{Key: "$set", Value: updateFields}}
-	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": user.Email}, updateBSON)
+func (usRepo *UserRepository) DeleteUser(email string) error {
+	_, err := usRepo.UserCollection.DeleteMany(context.TODO(), bson.M{"email": email})
 	return err
 }
 
-func (usRepo *UserRepository) DeleteUser(email string) error {
-	_, err := usRepo.UserCollection.DeleteMany(context.TODO(), bson.M{"email": email})
+func (usRepo *UserRepository) EraseUser(id, email string) error {
+	if _, err := usRepo.Sessions.DeleteMany(context.TODO(), bson.M{"userid": id}); err != nil {
+		return err
+	}
+	if _, err := usRepo.TokensCollection.DeleteMany(context.TODO(), bson.M{"userid": id}); err != nil {
+		return err
+	}
+	if _, err := usRepo.ResetPassword.DeleteMany(context.TODO(), bson.M{"email": email}); err != nil {
+		return err
+	}
+	if _, err := usRepo.MagicLinks.DeleteMany(context.TODO(), bson.M{"email": email}); err != nil {
+		return err
+	}
+	_, err := usRepo.UserCollection.DeleteOne(context.TODO(), bson.M{"id": id})
 	return err
 }
 
+func (usRepo *UserRepository) FindUsers(filter Domain.UserFilter) ([]Domain.User, int64, error) {
+	conditions := bson.A{}
+	if filter.Query != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(filter.Query), "$options": "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{bson.M{"username": pattern}, bson.M{"email": pattern}}})
+	}
+	if filter.Role != "" {
+		// Accounts from before multiple roles only have the single role field
+		conditions = append(conditions, bson.M{"$or": bson.A{bson.M{"roles": filter.Role}, bson.M{"roles": bson.M{"$in": bson.A{nil, bson.A{}}}, "role": filter.Role}}})
+	}
+	if filter.Provider != "" {
+		conditions = append(conditions, bson.M{"$or": bson.A{bson.M{"provider": filter.Provider}, bson.M{"linkedaccounts.provider": filter.Provider}}})
+	}
+	if filter.Verified != nil {
+		conditions = append(conditions, bson.M{"verfied": *filter.Verified})
+	}
+	if filter.Suspended != nil {
+		active := bson.M{"suspension": bson.M{"$ne": nil}, "$or": bson.A{bson.M{"suspension.until": nil}, bson.M{"suspension.until": bson.M{"$gt": time.Now()}}}}
+		if !*filter.Suspended {
+			active = bson.M{"$nor": bson.A{active}}
+		}
+		conditions = append(conditions, active)
+	}
+	created := bson.M{}
+	if !filter.CreatedAfter.IsZero() {
+		created["$gte"] = filter.CreatedAfter
+	}
+	if !filter.CreatedBefore.IsZero() {
+		created["$lt"] = filter.CreatedBefore
+	}
+	if len(created) > 0 {
+		conditions = append(conditions, bson.M{"createdat": created})
+	}
+	query := bson.M{}
+	if len(conditions) > 0 {
+		query["$and"] = conditions
+	}
+
+	total, err := usRepo.UserCollection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		return nil, 0, err
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdat", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := usRepo.UserCollection.Find(context.TODO(), query, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []Domain.User{}
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (usRepo *UserRepository) SetSuspension(id string, suspension *Domain.Suspension) error {
+	update := bson.M{"$set": bson.M{"suspension": suspension}}
+	if suspension == nil {
+		update = bson.M{"$unset": bson.M{"suspension": ""}}
+	}
+	result, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
 func (usRepo *UserRepository) Register(user *Domain.User) error {
 	_, err := usRepo.UserCollection.InsertOne(context.TODO(), user)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New("email already exists in database")
+	}
 	return err
 }
 
@@ -79,6 +245,26 @@ func (usRepo *UserRepository) GetUserByEmail(email string) (*Domain.User, error)
 	return &user, err
 }
 
+func (usRepo *UserRepository) GetUserByID(id string) (*Domain.User, error) {
+	var user Domain.User
+	err := usRepo.UserCollection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&user)
+	return &user, err
+}
+
+func (usRepo *UserRepository) GetUsersByIDs(ids []string) ([]Domain.User, error) {
+	cursor, err := usRepo.UserCollection.Find(context.TODO(), bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []Domain.User{}
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (usRepo *UserRepository) UpdateUserProfile(user *Domain.User) (*Domain.User, error) {
 	updateFields := bson.M{
 		"username": user.Username,
@@ -111,8 +297,17 @@ func (usRepo *UserRepository) UpdateUserProfile(user *Domain.User) (*Domain.User
 }
 
 func (usRepo *UserRepository) UpdateUserRole(email string, role string) (*Domain.User, error) {
+	return usRepo.UpdateUserRoles(email, []string{role})
+}
+
+// UpdateUserRoles keeps the legacy single role field in step with the first role
+func (usRepo *UserRepository) UpdateUserRoles(email string, roles []string) (*Domain.User, error) {
 	filter := bson.M{"email": email}
-	update := bson.M{"$set": bson.M{"role": role}}
+	primary := ""
+	if len(roles) > 0 {
+		primary = roles[0]
+	}
+	update := bson.M{"$set": bson.M{"roles": roles, "role": primary}}
 
 	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), filter, update)
 	if err != nil {
@@ -133,32 +328,264 @@ func (usRepo *UserRepository) StoreToken(token Domain.RefreshTokenStorage) error
 	return err
 }
 
-func (usRepo *UserRepository) GetRefreshToken(email string) (string, error) {
+func (usRepo *UserRepository) GetRefreshToken(tokenHash string) (Domain.RefreshTokenStorage, error) {
 	var tokenData Domain.RefreshTokenStorage
-	err := usRepo.TokensCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&tokenData)
-	return tokenData.Token, err
+	err := usRepo.TokensCollection.FindOne(context.TODO(), bson.M{"tokenhash": tokenHash}).Decode(&tokenData)
+	return tokenData, err
 }
 
-func (usRepo *UserRepository) DeleteToken(email string) error {
-	filter := bson.M{"email": email}
-	_, err := usRepo.TokensCollection.DeleteOne(context.TODO(), filter)
+// MarkRefreshTokenUsed reports false when the token was already used, so two
+// concurrent refreshes with the same token can't both succeed
+func (usRepo *UserRepository) MarkRefreshTokenUsed(tokenHash string) (bool, error) {
+	filter := bson.M{"tokenhash": tokenHash, "used": false}
+	result, err := usRepo.TokensCollection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"used": true}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (usRepo *UserRepository) RevokeTokenFamily(familyID string) error {
+	filter := bson.M{"familyid": familyID}
+	_, err := usRepo.TokensCollection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"revoked": true}})
 	return err
 }
 
-func (usRepo *UserRepository) AddToBlackList(token, email string) error {
-	_, err := usRepo.BlackList.InsertOne(context.TODO(), Domain.RefreshTokenStorage{Token: token, Email: email})
+func (usRepo *UserRepository) CreateSession(session Domain.Session) error {
+	_, err := usRepo.Sessions.InsertOne(context.TODO(), session)
 	return err
 }
 
-func (usRepo *UserRepository) DeleteFromBlackList(email string) error {
-	filter := bson.M{"email": email}
-	_, err := usRepo.BlackList.DeleteOne(context.TODO(), filter)
+func (usRepo *UserRepository) TouchSession(id string, device Domain.DeviceInfo) error {
+	update := bson.M{"$set": bson.M{"lastusedat": time.Now(), "useragent": device.UserAgent, "ip": device.IP}}
+	_, err := usRepo.Sessions.UpdateOne(context.TODO(), bson.M{"id": id}, update)
 	return err
 }
 
-func (usRepo *UserRepository) RetriveFromBlackList(email string) (string, error) {
-	var TokenData Domain.RefreshTokenStorage
-	filter := bson.M{"email": email}
-	err := usRepo.BlackList.FindOne(context.TODO(), filter).Decode(&TokenData)
-	return TokenData.Token, err
+func (usRepo *UserRepository) GetSession(id string) (Domain.Session, error) {
+	var session Domain.Session
+	err := usRepo.Sessions.FindOne(context.TODO(), bson.M{"id": id}).Decode(&session)
+	return session, err
+}
+
+func (usRepo *UserRepository) GetSessions(userID string) ([]Domain.Session, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "lastusedat", Value: -1}})
+	cursor, err := usRepo.Sessions.Find(context.TODO(), bson.M{"userid": userID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	sessions := []Domain.Session{}
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends a session and invalidates every refresh token it was issued
+func (usRepo *UserRepository) RevokeSession(id string) error {
+	if _, err := usRepo.Sessions.DeleteOne(context.TODO(), bson.M{"id": id}); err != nil {
+		return err
+	}
+	return usRepo.RevokeTokenFamily(id)
+}
+
+// RevokeSessions ends every session of the user except exceptID, which may be empty
+func (usRepo *UserRepository) RevokeSessions(userID, exceptID string) error {
+	sessionFilter := bson.M{"userid": userID}
+	tokenFilter := bson.M{"userid": userID}
+	if exceptID != "" {
+		sessionFilter["id"] = bson.M{"$ne": exceptID}
+		tokenFilter["familyid"] = bson.M{"$ne": exceptID}
+	}
+	if _, err := usRepo.Sessions.DeleteMany(context.TODO(), sessionFilter); err != nil {
+		return err
+	}
+	_, err := usRepo.TokensCollection.UpdateMany(context.TODO(), tokenFilter, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+// RevokeClientSessions signs every user out of an OAuth client
+func (usRepo *UserRepository) RevokeClientSessions(clientID string) error {
+	cursor, err := usRepo.Sessions.Find(context.TODO(), bson.M{"clientid": clientID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+	var sessions []Domain.Session
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := usRepo.RevokeSession(session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteToken signs the user out of every device
+func (usRepo *UserRepository) DeleteToken(userID string) error {
+	filter := bson.M{"userid": userID}
+	_, err := usRepo.TokensCollection.DeleteMany(context.TODO(), filter)
+	return err
+}
+
+func (usRepo *UserRepository) UpdateUserAvatar(id string, avatar *Domain.Image) error {
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, bson.M{"$set": bson.M{"avatar": avatar}})
+	return err
+}
+
+func (usRepo *UserRepository) RefreshAvatar(avatar Domain.Image) error {
+	filter := bson.M{"avatar.mediaid": avatar.MediaID}
+	_, err := usRepo.UserCollection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"avatar": avatar}})
+	return err
+}
+
+func (usRepo *UserRepository) HasAvatar(mediaID string) (bool, error) {
+	count, err := usRepo.UserCollection.CountDocuments(context.TODO(), bson.M{"avatar.mediaid": mediaID})
+	return count > 0, err
+}
+
+func (usRepo *UserRepository) SetTOTP(id, secret string, enabled bool, recoveryCodes []string) error {
+	update := bson.M{"$set": bson.M{
+		"totpsecret":    secret,
+		"totpenabled":   enabled,
+		"totplaststep":  int64(0),
+		"recoverycodes": recoveryCodes,
+	}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, update)
+	return err
+}
+
+// ConsumeTOTPStep reports false when a code of this or a later step was
+// already accepted, so an observed code can't be replayed
+func (usRepo *UserRepository) ConsumeTOTPStep(id string, step int64) (bool, error) {
+	filter := bson.M{"id": id, "$or": bson.A{
+		bson.M{"totplaststep": bson.M{"$lt": step}},
+		bson.M{"totplaststep": bson.M{"$exists": false}},
+	}}
+	result, err := usRepo.UserCollection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"totplaststep": step}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the code, reporting false when it was not there
+func (usRepo *UserRepository) UseRecoveryCode(id, codeHash string) (bool, error) {
+	filter := bson.M{"id": id, "recoverycodes": codeHash}
+	result, err := usRepo.UserCollection.UpdateOne(context.TODO(), filter, bson.M{"$pull": bson.M{"recoverycodes": codeHash}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (usRepo *UserRepository) IncrementMFAFailures(id string) (int, error) {
+	var user Domain.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := usRepo.UserCollection.FindOneAndUpdate(context.TODO(), bson.M{"id": id}, bson.M{"$inc": bson.M{"mfafailures": 1}}, opts).Decode(&user)
+	return user.MFAFailures, err
+}
+
+func (usRepo *UserRepository) LockMFA(id string, until time.Time) error {
+	update := bson.M{"$set": bson.M{"mfalockeduntil": until, "mfafailures": 0}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, update)
+	return err
+}
+
+func (usRepo *UserRepository) ResetMFAFailures(id string) error {
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, bson.M{"$set": bson.M{"mfafailures": 0}})
+	return err
+}
+
+func (usRepo *UserRepository) StoreMagicLink(link Domain.MagicLink) error {
+	_, err := usRepo.MagicLinks.InsertOne(context.TODO(), link)
+	return err
+}
+
+// GetMagicLink reads the link and leaves it in place
+func (usRepo *UserRepository) GetMagicLink(tokenHash string) (Domain.MagicLink, error) {
+	var link Domain.MagicLink
+	err := usRepo.MagicLinks.FindOne(context.TODO(), bson.M{"tokenhash": tokenHash}).Decode(&link)
+	return link, err
+}
+
+// ConsumeMagicLink deletes the link as it reads it, so it works only once
+func (usRepo *UserRepository) ConsumeMagicLink(tokenHash string) (Domain.MagicLink, error) {
+	var link Domain.MagicLink
+	err := usRepo.MagicLinks.FindOneAndDelete(context.TODO(), bson.M{"tokenhash": tokenHash}).Decode(&link)
+	return link, err
+}
+
+func (usRepo *UserRepository) CountMagicLinks(email string, since time.Time) (int64, error) {
+	filter := bson.M{"email": email, "createdat": bson.M{"$gte": since}}
+	return usRepo.MagicLinks.CountDocuments(context.TODO(), filter)
+}
+
+func (usRepo *UserRepository) GetUserByLinkedAccount(provider, subject string) (*Domain.User, error) {
+	var user Domain.User
+	filter := bson.M{"linkedaccounts": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+	err := usRepo.UserCollection.FindOne(context.TODO(), filter).Decode(&user)
+	return &user, err
+}
+
+func (usRepo *UserRepository) AddLinkedAccount(id string, account Domain.LinkedAccount) error {
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, bson.M{"$push": bson.M{"linkedaccounts": account}})
+	return err
+}
+
+func (usRepo *UserRepository) RemoveLinkedAccount(id, provider string) error {
+	update := bson.M{"$pull": bson.M{"linkedaccounts": bson.M{"provider": provider}}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"id": id}, update)
+	return err
+}
+
+// SetVerified also drops the verification code, it can't be used again
+func (usRepo *UserRepository) SetVerified(email string) error {
+	update := bson.M{
+		"$set":   bson.M{"verfied": true},
+		"$unset": bson.M{"otphash": "", "otpexpiresat": "", "otpfailures": "", "otplockeduntil": ""},
+	}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": email}, update)
+	return err
+}
+
+// SetOTP replaces the verification code and gives it a fresh set of attempts
+func (usRepo *UserRepository) SetOTP(email, otpHash string, expiresAt time.Time) error {
+	update := bson.M{"$set": bson.M{"otphash": otpHash, "otpexpiresat": expiresAt, "otpsentat": time.Now(), "otpfailures": 0}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": email}, update)
+	return err
+}
+
+func (usRepo *UserRepository) IncrementOTPFailures(email string) (int, error) {
+	var user Domain.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := usRepo.UserCollection.FindOneAndUpdate(context.TODO(), bson.M{"email": email}, bson.M{"$inc": bson.M{"otpfailures": 1}}, opts).Decode(&user)
+	return user.OTPFailures, err
+}
+
+// LockOTP also throws the current code away, a new one has to be requested
+func (usRepo *UserRepository) LockOTP(email string, until time.Time) error {
+	update := bson.M{"$set": bson.M{"otplockeduntil": until, "otphash": "", "otpfailures": 0}}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": email}, update)
+	return err
+}
+
+// RenameEmail moves the account to a new address. Reset tokens and sign in
+// links were sent to the old address and stop working.
+func (usRepo *UserRepository) RenameEmail(oldEmail, newEmail string) error {
+	if _, err := usRepo.ResetPassword.DeleteMany(context.TODO(), bson.M{"email": oldEmail}); err != nil {
+		return err
+	}
+	if _, err := usRepo.MagicLinks.DeleteMany(context.TODO(), bson.M{"email": oldEmail}); err != nil {
+		return err
+	}
+	_, err := usRepo.UserCollection.UpdateOne(context.TODO(), bson.M{"email": oldEmail}, bson.M{"$set": bson.M{"email": newEmail}})
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New("email already exists in database")
+	}
+	return err
 }
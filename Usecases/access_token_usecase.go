@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxAccessTokenTTL = 365 * 24 * time.Hour
+	// Last used is only written again after this long, not on every request
+	accessTokenTouchInterval = time.Minute
+)
+
+type AccessTokenUseCase struct {
+	repo     Domain.AccessTokenRepositoryI
+	userRepo Domain.UserRepositoryI
+}
+
+func NewAccessTokenUseCase(r Domain.AccessTokenRepositoryI, ur Domain.UserRepositoryI) *AccessTokenUseCase {
+	return &AccessTokenUseCase{
+		repo:     r,
+		userRepo: ur,
+	}
+}
+
+// CreateAccessTokenUC returns the stored token and the secret, which can't be recovered later
+func (atUC *AccessTokenUseCase) CreateAccessTokenUC(userID, name string, scopes []string, ttl time.Duration) (Domain.AccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return Domain.AccessToken{}, "", errors.New("token name must be between 1 and 100 characters")
+	}
+	if ttl <= 0 || ttl > maxAccessTokenTTL {
+		return Domain.AccessToken{}, "", errors.New("token expiry must be between 1 and 365 days")
+	}
+	if len(scopes) == 0 {
+		return Domain.AccessToken{}, "", errors.New("at least one scope is required")
+	}
+	granted := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(Domain.Scopes, scope) {
+			return Domain.AccessToken{}, "", errors.New("unknown scope " + scope)
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return Domain.AccessToken{}, "", err
+	}
+	secret = Domain.AccessTokenPrefix + secret
+	now := time.Now()
+	token := Domain.AccessToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(secret),
+		Scopes:    granted,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := atUC.repo.StoreAccessToken(token); err != nil {
+		return Domain.AccessToken{}, "", err
+	}
+	return token, secret, nil
+}
+
+func (atUC *AccessTokenUseCase) ListAccessTokensUC(userID string) ([]Domain.AccessToken, error) {
+	return atUC.repo.GetAccessTokens(userID)
+}
+
+func (atUC *AccessTokenUseCase) RevokeAccessTokenUC(userID, id string) error {
+	return atUC.repo.DeleteAccessToken(id, userID)
+}
+
+// AuthenticateUC resolves a personal access token to its owner
+func (atUC *AccessTokenUseCase) AuthenticateUC(secret string) (*Domain.User, Domain.AccessToken, error) {
+	token, err := atUC.repo.GetAccessToken(hashToken(secret))
+	now := time.Now()
+	if err != nil || now.After(token.ExpiresAt) {
+		return nil, token, errors.New("invalid or expired access token")
+	}
+	user, err := atUC.userRepo.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, token, errors.New("invalid or expired access token")
+	}
+	if now.Sub(token.LastUsedAt) > accessTokenTouchInterval {
+		if err := atUC.repo.TouchAccessToken(token.ID, now); err != nil {
+			return nil, token, err
+		}
+		token.LastUsedAt = now
+	}
+	return user, token, nil
+}
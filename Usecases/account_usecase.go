@@ -0,0 +1,429 @@
+package usecases
+
+import (
+	"archive/zip"
+	"blog_api/Domain"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How long a data export can be downloaded
+const exportTTL = 7 * 24 * time.Hour
+
+type AccountUseCase struct {
+	repo        Domain.AccountRepositoryI
+	userRepo    Domain.UserRepositoryI
+	blogRepo    Domain.BlogRepositoryI
+	tokenRepo   Domain.AccessTokenRepositoryI
+	oauthRepo   Domain.OAuthRepositoryI
+	emailRepo   Domain.EmailChangeRepositoryI
+	auditRepo   Domain.AuditRepositoryI
+	media       Domain.MediaUseCaseI
+	store       Domain.BlobStore
+	pass_serv   Domain.PasswordServiceI
+	mailer      Domain.MailerI
+	gracePeriod time.Duration
+	jobs        chan string
+}
+
+func NewAccountUseCase(r Domain.AccountRepositoryI, ur Domain.UserRepositoryI, br Domain.BlogRepositoryI, tr Domain.AccessTokenRepositoryI, or Domain.OAuthRepositoryI, er Domain.EmailChangeRepositoryI, ar Domain.AuditRepositoryI, media Domain.MediaUseCaseI, store Domain.BlobStore, ps Domain.PasswordServiceI, mailr Domain.MailerI, gracePeriod time.Duration) *AccountUseCase {
+	return &AccountUseCase{
+		repo:        r,
+		userRepo:    ur,
+		blogRepo:    br,
+		tokenRepo:   tr,
+		oauthRepo:   or,
+		emailRepo:   er,
+		auditRepo:   ar,
+		media:       media,
+		store:       store,
+		pass_serv:   ps,
+		mailer:      mailr,
+		gracePeriod: gracePeriod,
+		jobs:        make(chan string, 100),
+	}
+}
+
+// RequestExportUC queues an export of the user's data. Asking again while
+// one is being built returns that one.
+func (acUC *AccountUseCase) RequestExportUC(user Domain.User) (Domain.DataExport, error) {
+	exports, err := acUC.repo.GetUserExports(user.ID)
+	if err != nil {
+		return Domain.DataExport{}, err
+	}
+	for _, export := range exports {
+		if export.Status == Domain.ExportPending || export.Status == Domain.ExportRunning {
+			return export, nil
+		}
+	}
+	now := time.Now()
+	export := Domain.DataExport{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Status:    Domain.ExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportTTL),
+	}
+	if err := acUC.repo.StoreExport(export); err != nil {
+		return Domain.DataExport{}, err
+	}
+	acUC.enqueue(export.ID)
+	return export, nil
+}
+
+func (acUC *AccountUseCase) ListExportsUC(userID string) ([]Domain.DataExport, error) {
+	return acUC.repo.GetUserExports(userID)
+}
+
+func (acUC *AccountUseCase) DownloadExportUC(userID, id string) (Domain.DataExport, []byte, error) {
+	export, err := acUC.repo.GetExport(id)
+	if err != nil || export.UserID != userID || time.Now().After(export.ExpiresAt) {
+		return Domain.DataExport{}, nil, errors.New("export not found")
+	}
+	if export.Status != Domain.ExportReady {
+		return export, nil, errors.New("export not ready")
+	}
+	data, err := acUC.store.Get(export.Key)
+	return export, data, err
+}
+
+func (acUC *AccountUseCase) enqueue(id string) {
+	select {
+	case acUC.jobs <- id:
+	default:
+		log.Printf("export queue full, building %s out of band", id)
+		go acUC.runJob(id)
+	}
+}
+
+// RunExportWorker builds queued exports until the queue is closed. Exports a
+// restart interrupted are queued again first.
+func (acUC *AccountUseCase) RunExportWorker() {
+	unfinished, err := acUC.repo.GetExportsByStatus(Domain.ExportPending, Domain.ExportRunning)
+	if err != nil {
+		log.Print("failed to load unfinished exports: ", err)
+	}
+	for _, export := range unfinished {
+		acUC.enqueue(export.ID)
+	}
+	for id := range acUC.jobs {
+		acUC.runJob(id)
+	}
+}
+
+func (acUC *AccountUseCase) runJob(id string) {
+	if err := acUC.BuildExportUC(id); err != nil {
+		log.Printf("failed to build export %s: %v", id, err)
+		export, err := acUC.repo.GetExport(id)
+		if err != nil {
+			return
+		}
+		export.Status = Domain.ExportFailed
+		export.FinishedAt = time.Now()
+		if err := acUC.repo.UpdateExport(export); err != nil {
+			log.Printf("failed to mark export %s as failed: %v", id, err)
+		}
+	}
+}
+
+// BuildExportUC stores the archive of the export in the blob store and lets
+// the user know it can be downloaded
+func (acUC *AccountUseCase) BuildExportUC(id string) error {
+	export, err := acUC.repo.GetExport(id)
+	if err != nil {
+		return err
+	}
+	export.Status = Domain.ExportRunning
+	if err := acUC.repo.UpdateExport(export); err != nil {
+		return err
+	}
+	user, err := acUC.userRepo.GetUserByID(export.UserID)
+	if err != nil {
+		return err
+	}
+	data, err := acUC.archive(*user)
+	if err != nil {
+		return err
+	}
+	export.Key = "exports/" + export.ID + ".zip"
+	if err := acUC.store.Put(export.Key, data, "application/zip"); err != nil {
+		return err
+	}
+	now := time.Now()
+	export.Status = Domain.ExportReady
+	export.Size = int64(len(data))
+	export.FinishedAt = now
+	export.ExpiresAt = now.Add(exportTTL)
+	if err := acUC.repo.UpdateExport(export); err != nil {
+		return err
+	}
+	if err := acUC.mailer.SendExportReadyEmail(user.Email); err != nil {
+		log.Print(err.Error())
+	}
+	return nil
+}
+
+// exportedProfile is the part of a user that belongs in an export, password
+// hashes and second factor secrets stay out
+type exportedProfile struct {
+	ID             string
+	Username       string
+	Email          string
+	Bio            string
+	Role           string
+	Roles          []string
+	Verified       bool
+	Provider       string
+	Avatar         *Domain.Image
+	LinkedAccounts []Domain.LinkedAccount
+	TOTPEnabled    bool
+}
+
+// archive writes everything stored about the user to a ZIP, one JSON file per kind
+func (acUC *AccountUseCase) archive(user Domain.User) ([]byte, error) {
+	blogs, err := acUC.blogRepo.GetBlogsByOwner(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := acUC.blogRepo.GetCommentsBy(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	reviewComments, err := acUC.blogRepo.GetReviewCommentsBy(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := acUC.blogRepo.GetReactions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	readingList, err := acUC.blogRepo.FetchReadLaterBlog(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := acUC.userRepo.GetSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", exportedProfile{
+			ID:             user.ID,
+			Username:       user.Username,
+			Email:          user.Email,
+			Bio:            user.Bio,
+			Role:           user.Role,
+			Roles:          user.Roles,
+			Verified:       user.Verfied,
+			Provider:       user.Provider,
+			Avatar:         user.Avatar,
+			LinkedAccounts: user.LinkedAccounts,
+			TOTPEnabled:    user.TOTPEnabled,
+		}},
+		{"blogs.json", blogs},
+		{"comments.json", comments},
+		{"review_comments.json", reviewComments},
+		{"reactions.json", reactions},
+		{"reading_list.json", append([]string{}, readingList...)},
+		{"sessions.json", sessions},
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RemoveExpiredExportsUC deletes exports past their download window, and
+// those that never finished
+func (acUC *AccountUseCase) RemoveExpiredExportsUC() (int, error) {
+	expired, err := acUC.repo.GetExportsBefore(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, export := range expired {
+		if err := acUC.removeExport(export); err != nil {
+			log.Printf("failed to remove export %s: %v", export.ID, err)
+			continue
+		}
+		removed += 1
+	}
+	return removed, nil
+}
+
+func (acUC *AccountUseCase) removeExport(export Domain.DataExport) error {
+	if export.Key != "" {
+		if err := acUC.store.Delete(export.Key); err != nil {
+			return err
+		}
+	}
+	return acUC.repo.DeleteExport(export.ID)
+}
+
+// ScheduleDeletionUC erases the account once the grace period is over, until
+// then it can be cancelled. Accounts with a password have to enter it again.
+func (acUC *AccountUseCase) ScheduleDeletionUC(user Domain.User, password, posts string) (Domain.AccountDeletion, error) {
+	if posts != Domain.PostsDelete && posts != Domain.PostsAnonymize {
+		return Domain.AccountDeletion{}, errors.New("posts must be delete or anonymize")
+	}
+	if user.Password != "" && !acUC.pass_serv.Compare(user.Password, password) {
+		return Domain.AccountDeletion{}, errors.New("invalid password")
+	}
+	now := time.Now()
+	deletion := Domain.AccountDeletion{
+		UserID:      user.ID,
+		Posts:       posts,
+		RequestedAt: now,
+		DeleteAt:    now.Add(acUC.gracePeriod),
+	}
+	if err := acUC.repo.ScheduleDeletion(deletion); err != nil {
+		return Domain.AccountDeletion{}, err
+	}
+	if err := acUC.mailer.SendAccountDeletionEmail(user.Email, deletion.DeleteAt); err != nil {
+		log.Print(err.Error())
+	}
+	return deletion, nil
+}
+
+func (acUC *AccountUseCase) GetDeletionUC(userID string) (Domain.AccountDeletion, error) {
+	deletion, err := acUC.repo.GetDeletion(userID)
+	if err != nil {
+		return deletion, errors.New("no deletion scheduled")
+	}
+	return deletion, nil
+}
+
+func (acUC *AccountUseCase) CancelDeletionUC(userID string) error {
+	cancelled, err := acUC.repo.DeleteDeletion(userID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return errors.New("no deletion scheduled")
+	}
+	return nil
+}
+
+// EraseDueAccountsUC erases the accounts whose grace period is over
+func (acUC *AccountUseCase) EraseDueAccountsUC() (int, error) {
+	due, err := acUC.repo.GetDeletionsDue(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	erased := 0
+	for _, deletion := range due {
+		if err := acUC.erase(deletion); err != nil {
+			log.Printf("failed to erase account %s: %v", deletion.UserID, err)
+			continue
+		}
+		erased += 1
+	}
+	return erased, nil
+}
+
+// erase removes everything personal about the user. The scheduled deletion
+// is dropped last so a failed run is picked up again by the next one.
+func (acUC *AccountUseCase) erase(deletion Domain.AccountDeletion) error {
+	id := deletion.UserID
+	// A run that failed halfway may have removed the user already
+	email := ""
+	if user, err := acUC.userRepo.GetUserByID(id); err == nil {
+		email = user.Email
+	}
+
+	// Comments on other people's blogs follow the same choice as the user's own blogs
+	if deletion.Posts == Domain.PostsAnonymize {
+		if err := acUC.blogRepo.ReassignBlogs(id, Domain.DeletedUserID); err != nil {
+			return err
+		}
+		if err := acUC.blogRepo.ReassignComments(id, Domain.DeletedUserID); err != nil {
+			return err
+		}
+	} else {
+		if err := acUC.blogRepo.DeleteCommentsBy(id); err != nil {
+			return err
+		}
+		blogs, err := acUC.blogRepo.GetBlogsByOwner(id)
+		if err != nil {
+			return err
+		}
+		for _, blog := range blogs {
+			if err := acUC.blogRepo.PurgeBlog(blog.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := acUC.blogRepo.ForgetUser(id, Domain.DeletedUserID); err != nil {
+		return err
+	}
+	if err := acUC.media.ReleaseUploadsUC(id); err != nil {
+		return err
+	}
+
+	tokens, err := acUC.tokenRepo.GetAccessTokens(id)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := acUC.tokenRepo.DeleteAccessToken(token.ID, id); err != nil {
+			return err
+		}
+	}
+	clients, err := acUC.oauthRepo.GetClients(id)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if err := acUC.userRepo.RevokeClientSessions(client.ID); err != nil {
+			return err
+		}
+		if err := acUC.oauthRepo.DeleteClient(client.ID, id); err != nil {
+			return err
+		}
+	}
+
+	exports, err := acUC.repo.GetUserExports(id)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := acUC.removeExport(export); err != nil {
+			return err
+		}
+	}
+	if email != "" {
+		if err := acUC.emailRepo.DeleteEmailChange(email); err != nil {
+			return err
+		}
+	}
+	// The entries stay, only where the requests came from is forgotten
+	if err := acUC.auditRepo.EraseActorDetails(id); err != nil {
+		return err
+	}
+	if err := acUC.userRepo.EraseUser(id, email); err != nil {
+		return err
+	}
+	_, err = acUC.repo.DeleteDeletion(id)
+	return err
+}
@@ -0,0 +1,188 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Largest page of users an admin can ask for
+const maxUserPage = 100
+
+type AdminUseCase struct {
+	userRepo  Domain.UserRepositoryI
+	blogRepo  Domain.BlogRepositoryI
+	mediaRepo Domain.MediaRepositoryI
+	tokenRepo Domain.AccessTokenRepositoryI
+	users     Domain.UserUsecaseI
+	policy    Domain.PolicyI
+	audit     auditLog
+}
+
+func NewAdminUseCase(ur Domain.UserRepositoryI, br Domain.BlogRepositoryI, mr Domain.MediaRepositoryI, tr Domain.AccessTokenRepositoryI, users Domain.UserUsecaseI, pl Domain.PolicyI, ar Domain.AuditRepositoryI) *AdminUseCase {
+	return &AdminUseCase{
+		userRepo:  ur,
+		blogRepo:  br,
+		mediaRepo: mr,
+		tokenRepo: tr,
+		users:     users,
+		policy:    pl,
+		audit:     auditLog{repo: ar},
+	}
+}
+
+func (adUC *AdminUseCase) ListUsersUC(filter Domain.UserFilter) ([]Domain.User, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > maxUserPage {
+		filter.Limit = maxUserPage
+	}
+	filter.Offset = max(filter.Offset, 0)
+	filter.Query = strings.TrimSpace(filter.Query)
+	return adUC.userRepo.FindUsers(filter)
+}
+
+// GetUserDetailUC returns the user together with counts of what they have done
+func (adUC *AdminUseCase) GetUserDetailUC(id string) (*Domain.User, Domain.UserActivity, error) {
+	var activity Domain.UserActivity
+	user, err := adUC.userRepo.GetUserByID(id)
+	if err != nil {
+		return nil, activity, errors.New("user not found")
+	}
+
+	blogs, err := adUC.blogRepo.GetBlogsByOwner(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	for _, blog := range blogs {
+		switch {
+		case blog.DeletedAt != nil:
+			activity.TrashedBlogs += 1
+		case blog.Status == Domain.StatusPublished || blog.Status == "":
+			activity.PublishedBlogs += 1
+		}
+	}
+	activity.Blogs = len(blogs) - activity.TrashedBlogs
+	comments, err := adUC.blogRepo.GetReviewCommentsBy(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.ReviewComments = len(comments)
+	reactions, err := adUC.blogRepo.GetReactions(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.Reactions = len(reactions)
+	readingList, err := adUC.blogRepo.FetchReadLaterBlog(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.ReadingList = len(readingList)
+
+	sessions, err := adUC.userRepo.GetSessions(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.Sessions = len(sessions)
+	tokens, err := adUC.tokenRepo.GetAccessTokens(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.AccessTokens = len(tokens)
+	uploads, err := adUC.mediaRepo.GetUserMedia(id)
+	if err != nil {
+		return nil, activity, err
+	}
+	activity.Uploads = len(uploads)
+	for _, media := range uploads {
+		activity.StorageUsed += media.Size
+	}
+	return user, activity, nil
+}
+
+// SuspendUserUC keeps the user out until the given time, or for good when
+// until is nil. They are signed out everywhere.
+func (adUC *AdminUseCase) SuspendUserUC(actor Domain.User, id, reason string, until *time.Time) (*Domain.User, error) {
+	target, err := adUC.userRepo.GetUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !adUC.policy.Can(actor, Domain.ActionUserSuspend, *target) {
+		return nil, Domain.ErrForbidden
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("a reason is required")
+	}
+	now := time.Now()
+	if until != nil && !until.After(now) {
+		return nil, errors.New("suspension must end in the future")
+	}
+	suspension := &Domain.Suspension{Reason: reason, By: actor.ID, At: now, Until: until}
+	if err := adUC.userRepo.SetSuspension(id, suspension); err != nil {
+		return nil, err
+	}
+	if err := adUC.userRepo.RevokeSessions(id, ""); err != nil {
+		return nil, err
+	}
+	before := userSnapshot(*target)
+	target.Suspension = suspension
+	adUC.audit.record(actor, Domain.AuditUserSuspend, "user", id, before, userSnapshot(*target))
+	return target, nil
+}
+
+func (adUC *AdminUseCase) UnsuspendUserUC(actor Domain.User, id string) (*Domain.User, error) {
+	target, err := adUC.userRepo.GetUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !adUC.policy.Can(actor, Domain.ActionUserSuspend, *target) {
+		return nil, Domain.ErrForbidden
+	}
+	if target.Suspension == nil {
+		return nil, errors.New("user is not suspended")
+	}
+	if err := adUC.userRepo.SetSuspension(id, nil); err != nil {
+		return nil, err
+	}
+	before := userSnapshot(*target)
+	target.Suspension = nil
+	adUC.audit.record(actor, Domain.AuditUserUnsuspend, "user", id, before, userSnapshot(*target))
+	return target, nil
+}
+
+// ForceLogoutUC ends every session of the user and revokes their personal
+// access tokens, returning how many tokens there were
+func (adUC *AdminUseCase) ForceLogoutUC(actor Domain.User, id string) (int64, error) {
+	target, err := adUC.userRepo.GetUserByID(id)
+	if err != nil {
+		return 0, errors.New("user not found")
+	}
+	if !adUC.policy.Can(actor, Domain.ActionUserManage, *target) {
+		return 0, Domain.ErrForbidden
+	}
+	if err := adUC.userRepo.RevokeSessions(id, ""); err != nil {
+		return 0, err
+	}
+	revoked, err := adUC.tokenRepo.DeleteAccessTokens(id)
+	if err != nil {
+		return 0, err
+	}
+	adUC.audit.record(actor, Domain.AuditUserForceLogout, "user", id, nil, map[string]any{"access_tokens_revoked": revoked})
+	return revoked, nil
+}
+
+// TriggerPasswordResetUC emails the user a password reset link
+func (adUC *AdminUseCase) TriggerPasswordResetUC(actor Domain.User, id string) error {
+	target, err := adUC.userRepo.GetUserByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if !adUC.policy.Can(actor, Domain.ActionUserManage, *target) {
+		return Domain.ErrForbidden
+	}
+	if err := adUC.users.ForgotPasswordUsecase(target.Email); err != nil {
+		return err
+	}
+	adUC.audit.record(actor, Domain.AuditPasswordResetTrigger, "user", id, nil, nil)
+	return nil
+}
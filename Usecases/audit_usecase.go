@@ -0,0 +1,119 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Largest page of audit entries an admin can ask for
+const maxAuditPage = 200
+
+// auditLog writes entries on behalf of the other usecases. A failed write is
+// logged and does not undo or fail the action it describes.
+type auditLog struct {
+	repo Domain.AuditRepositoryI
+}
+
+// record notes that actor did action to the target. An actor without an ID
+// is the server itself. before and after are snapshots of the target and
+// may be nil.
+func (al auditLog) record(actor Domain.User, action, targetType, targetID string, before, after any) {
+	entry := Domain.AuditEntry{
+		ID:         uuid.New().String(),
+		Time:       time.Now(),
+		ActorID:    actor.ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         actor.Device.IP,
+		UserAgent:  actor.Device.UserAgent,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+	}
+	if err := al.repo.AppendAuditEntry(entry); err != nil {
+		log.Printf("failed to write audit entry %s %s/%s: %v", action, targetType, targetID, err)
+	}
+}
+
+func snapshot(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Print("failed to snapshot audit target: ", err)
+		return ""
+	}
+	return string(data)
+}
+
+// userSnapshot holds what the audit log keeps of a user. The entry already
+// names the user by ID, so neither secrets nor contact details are kept and
+// nothing in it has to be erased with the account.
+func userSnapshot(user Domain.User) map[string]any {
+	return map[string]any{
+		"roles":        user.Roles,
+		"verified":     user.Verfied,
+		"totp_enabled": user.TOTPEnabled,
+		"suspension":   user.Suspension,
+	}
+}
+
+// blogSnapshot holds what the audit log keeps of a blog, the content is left out
+func blogSnapshot(blog Domain.Blog) map[string]any {
+	return map[string]any{
+		"title":      blog.Title,
+		"owner_id":   blog.OwnerID,
+		"co_authors": blog.CoAuthors,
+		"status":     blog.Status,
+		"deleted_at": blog.DeletedAt,
+	}
+}
+
+type AuditUseCase struct {
+	repo Domain.AuditRepositoryI
+}
+
+func NewAuditUseCase(r Domain.AuditRepositoryI) *AuditUseCase {
+	return &AuditUseCase{
+		repo: r,
+	}
+}
+
+func (auUC *AuditUseCase) QueryAuditUC(filter Domain.AuditFilter) ([]Domain.AuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > maxAuditPage {
+		filter.Limit = maxAuditPage
+	}
+	filter.Offset = max(filter.Offset, 0)
+	return auUC.repo.FindAuditEntries(filter)
+}
+
+// ExportAuditUC hands every matching entry to fn, oldest first
+func (auUC *AuditUseCase) ExportAuditUC(filter Domain.AuditFilter, fn func(Domain.AuditEntry) error) error {
+	return auUC.repo.StreamAuditEntries(filter, fn)
+}
+
+// VerifyAuditUC walks the whole chain and stops at the first entry that does
+// not follow from the one before it. Entries written before the chain
+// existed carry no sequence number and are skipped.
+func (auUC *AuditUseCase) VerifyAuditUC() (Domain.AuditVerification, error) {
+	result := Domain.AuditVerification{Valid: true}
+	var prev Domain.AuditEntry
+	err := auUC.repo.StreamAuditEntries(Domain.AuditFilter{}, func(entry Domain.AuditEntry) error {
+		if entry.Seq == 0 || !result.Valid {
+			return nil
+		}
+		result.Entries++
+		if entry.Seq != prev.Seq+1 || entry.PrevHash != prev.Hash || entry.Hash != entry.ChainHash() {
+			result.Valid = false
+			result.BrokenAt = entry.Seq
+		}
+		prev = entry
+		return nil
+	})
+	return result, err
+}
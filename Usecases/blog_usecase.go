@@ -7,22 +7,43 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type BlogUseCase struct {
 	Repository Domain.BlogRepositoryI
+	Users      Domain.UserRepositoryI
+	Policy     Domain.PolicyI
+	audit      auditLog
 }
 
-func NewBlogUseCase(Repo Domain.BlogRepositoryI) *BlogUseCase {
+func NewBlogUseCase(Repo Domain.BlogRepositoryI, Users Domain.UserRepositoryI, Policy Domain.PolicyI, Audit Domain.AuditRepositoryI) *BlogUseCase {
 	return &BlogUseCase{
 		Repository: Repo,
+		Users:      Users,
+		Policy:     Policy,
+		audit:      auditLog{repo: Audit},
 	}
 }
 
-func (BlgUseCase *BlogUseCase) CreateBlogUC(blog Domain.Blog) error {
+// Allowed moves of the editorial review state machine
+var reviewTransitions = map[string][]string{
+	Domain.StatusDraft:            {Domain.StatusInReview},
+	Domain.StatusInReview:         {Domain.StatusChangesRequested, Domain.StatusApproved, Domain.StatusDraft},
+	Domain.StatusChangesRequested: {Domain.StatusInReview, Domain.StatusDraft},
+	Domain.StatusApproved:         {Domain.StatusPublished, Domain.StatusDraft},
+	Domain.StatusPublished:        {Domain.StatusDraft},
+}
+
+func (BlgUseCase *BlogUseCase) CreateBlogUC(blog Domain.Blog, actor Domain.User) error {
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogCreate, blog) {
+		return Domain.ErrForbidden
+	}
 	blog.ID = uuid.New().String()
+	blog.Status = Domain.StatusDraft
+	blog.Revision = 1
 	err := BlgUseCase.Repository.Create(&blog)
 	return err
 }
@@ -36,16 +57,16 @@ func (BlgUseCase *BlogUseCase) AddLikeUC(lt Domain.LikeTracker) error {
 	return BlgUseCase.Repository.CreateLikeTk(lt)
 }
 
-func (BlgUseCase *BlogUseCase) CheckIfLiked(user_email, blogId string) (int, error) {
-	if user_email == "" || blogId == "" {
-		return 0, errors.New("invalid blog id or user email when checking liked")
+func (BlgUseCase *BlogUseCase) CheckIfLiked(userID, blogId string) (int, error) {
+	if userID == "" || blogId == "" {
+		return 0, errors.New("invalid blog id or user id when checking liked")
 	}
-	liked, err := BlgUseCase.Repository.FindLiked(user_email, blogId)
+	liked, err := BlgUseCase.Repository.FindLiked(userID, blogId)
 	if err != nil && err.Error() == "mongo: no documents in result" {
 		// If user hasnt liked this post before, create a new doc to like it
 		var Liketrk Domain.LikeTracker
 		Liketrk.BlogID = blogId
-		Liketrk.UserEmail = user_email
+		Liketrk.UserID = userID
 		Liketrk.Liked = 0
 
 		err := BlgUseCase.Repository.CreateLikeTk(Liketrk)
@@ -65,7 +86,7 @@ func (BlgUsecase *BlogUseCase) Likes(id string) (int64, error) {
 	if id == "" {
 		return 0, errors.New("id field can not be empty")
 	}
-	_, err := BlgUsecase.Repository.GetBlog(id)
+	_, err := BlgUsecase.Repository.GetPublishedBlog(id)
 	if err != nil {
 		return 0, err
 	}
@@ -77,7 +98,7 @@ func (BlgUsecase *BlogUseCase) Dislikes(id string) (int64, error) {
 	if id == "" {
 		return 0, errors.New("id field can not be empty")
 	}
-	_, err := BlgUsecase.Repository.GetBlog(id)
+	_, err := BlgUsecase.Repository.GetPublishedBlog(id)
 	if err != nil {
 		return 0, err
 	}
@@ -86,50 +107,215 @@ func (BlgUsecase *BlogUseCase) Dislikes(id string) (int64, error) {
 
 func (BlgUseCase *BlogUseCase) SearchBlogUC(searchBlog Domain.Blog) ([]Domain.Blog, error) {
 	// Check if required fields are available
-	if searchBlog.Title == "" && searchBlog.Owner_email == "" {
+	if searchBlog.Title == "" && searchBlog.OwnerID == "" {
 		return []Domain.Blog{}, errors.New("can't search for blog with empty searching fileds.(Title or Owner)")
 	}
-	return BlgUseCase.Repository.SearchBlog(&searchBlog)
+	blogs, err := BlgUseCase.Repository.SearchBlog(&searchBlog)
+	if err != nil {
+		return nil, err
+	}
+	return BlgUseCase.withAuthors(blogs), nil
 }
 
-func (BlgUC *BlogUseCase) UpdateBlogUC(updatedBlog Domain.Blog) error {
+func (BlgUC *BlogUseCase) UpdateBlogUC(updatedBlog Domain.Blog, actor Domain.User) error {
 	// Handle empty blog update
 	if updatedBlog.Content == "" && updatedBlog.Title == "" && updatedBlog.Tags == nil {
 		return errors.New("can't update into empty blog")
 	}
-	return BlgUC.Repository.UpdateBlog(&updatedBlog)
+	existing, err := BlgUC.Repository.GetBlog(updatedBlog.ID)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogUpdate, existing) {
+		return Domain.ErrForbidden
+	}
+	updatedBlog.Revision = existing.Revision
+	if !contentChanged(existing, updatedBlog) {
+		return BlgUC.Repository.UpdateBlog(&updatedBlog)
+	}
+
+	// Every content edit is a new revision. Unless the blog is still a draft it
+	// goes back to being one, so no content goes public or gets approved
+	// without an editor having seen it.
+	updatedBlog.Revision += 1
+	if err := BlgUC.Repository.UpdateBlog(&updatedBlog); err != nil {
+		return err
+	}
+	if existing.Status == Domain.StatusDraft {
+		return nil
+	}
+	existing.Revision = updatedBlog.Revision
+	return BlgUC.moveTo(existing, Domain.StatusDraft, actor)
 }
 
-func (BlgUseCase *BlogUseCase) GetLikedUC(email string) ([]Domain.Blog, error) {
-	blogIDs, err := BlgUseCase.Repository.GetLiked(email)
+func contentChanged(old, updated Domain.Blog) bool {
+	if updated.Title != "" && updated.Title != old.Title {
+		return true
+	}
+	if updated.Content != "" && updated.Content != old.Content {
+		return true
+	}
+	if updated.Tags == nil {
+		return false
+	}
+	if len(updated.Tags) != len(old.Tags) {
+		return true
+	}
+	for i := range updated.Tags {
+		if updated.Tags[i] != old.Tags[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (BlgUseCase *BlogUseCase) GetLikedUC(userID string) ([]Domain.Blog, error) {
+	blogIDs, err := BlgUseCase.Repository.GetLiked(userID)
 	if err != nil {
 		return []Domain.Blog{}, err
 	}
 	result := []Domain.Blog{}
 	for _, id := range blogIDs {
-		blg, err := BlgUseCase.Repository.GetBlog(id)
+		blg, err := BlgUseCase.Repository.GetPublishedBlog(id)
 		if err == nil {
 			result = append(result, blg)
 		}
 	}
-	return result, nil
+	return BlgUseCase.withAuthors(result), nil
 }
 
 func (BlgUseCase *BlogUseCase) GetAllBlogUC(limit int, offset int) ([]Domain.Blog, error) {
-	return BlgUseCase.Repository.GetAllBlogs(limit, offset)
+	blogs, err := BlgUseCase.Repository.GetAllBlogs(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return BlgUseCase.withAuthors(blogs), nil
 }
 
-func (BlgUC *BlogUseCase) DeleteBlogUC(id string) error {
-	err := BlgUC.Repository.DeleteBlog(id)
-	return err
+func (BlgUC *BlogUseCase) DeleteBlogUC(id string, actor Domain.User) error {
+	blog, err := BlgUC.Repository.GetBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogDelete, blog) {
+		return Domain.ErrForbidden
+	}
+	if err := BlgUC.Repository.DeleteBlog(id); err != nil {
+		return err
+	}
+	BlgUC.audit.record(actor, Domain.AuditBlogDelete, "blog", id, blogSnapshot(blog), nil)
+	return nil
+}
+
+func (BlgUC *BlogUseCase) GetTrashUC(ownerID string) ([]Domain.Blog, error) {
+	blogs, err := BlgUC.Repository.GetTrashedBlogs(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return BlgUC.withAuthors(blogs), nil
+}
+
+func (BlgUC *BlogUseCase) RestoreBlogUC(id string, actor Domain.User) error {
+	blog, err := BlgUC.Repository.GetTrashedBlog(id)
+	if err != nil {
+		return err
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogRestore, blog) {
+		return Domain.ErrForbidden
+	}
+	if err := BlgUC.Repository.RestoreBlog(id); err != nil {
+		return err
+	}
+	restored := blog
+	restored.DeletedAt = nil
+	BlgUC.audit.record(actor, Domain.AuditBlogRestore, "blog", id, blogSnapshot(blog), blogSnapshot(restored))
+	return nil
+}
+
+func (BlgUC *BlogUseCase) PurgeBlogUC(id string, actor Domain.User) error {
+	blog, err := BlgUC.Repository.GetTrashedBlog(id)
+	if err != nil {
+		return err
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogPurge, blog) {
+		return Domain.ErrForbidden
+	}
+	if err := BlgUC.Repository.PurgeBlog(id); err != nil {
+		return err
+	}
+	BlgUC.audit.record(actor, Domain.AuditBlogPurge, "blog", id, blogSnapshot(blog), nil)
+	return nil
+}
+
+// PurgeExpiredUC permanently removes blogs that stayed in the trash longer than retention
+func (BlgUC *BlogUseCase) PurgeExpiredUC(retention time.Duration) (int, error) {
+	blogs, err := BlgUC.Repository.GetTrashedBefore(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	for i, blog := range blogs {
+		if err := BlgUC.Repository.PurgeBlog(blog.ID); err != nil {
+			return i, err
+		}
+		BlgUC.audit.record(Domain.User{}, Domain.AuditBlogPurge, "blog", blog.ID, blogSnapshot(blog), nil)
+	}
+	return len(blogs), nil
 }
 
 func (BlgUseCase *BlogUseCase) FilterBlogUC(filterBlog Domain.Blog) ([]Domain.Blog, error) {
-	return BlgUseCase.Repository.FilterBlog(&filterBlog)
+	blogs, err := BlgUseCase.Repository.FilterBlog(&filterBlog)
+	if err != nil {
+		return nil, err
+	}
+	return BlgUseCase.withAuthors(blogs), nil
 }
 
 func (BlgUseCase *BlogUseCase) GetByIdBlogUC(id string) (Domain.Blog, error) {
-	return BlgUseCase.Repository.GetBlog(id)
+	blog, err := BlgUseCase.Repository.GetPublishedBlog(id)
+	if err != nil {
+		return blog, err
+	}
+	return BlgUseCase.withAuthors([]Domain.Blog{blog})[0], nil
+}
+
+func (BlgUseCase *BlogUseCase) PreviewBlogUC(id string, actor Domain.User) (Domain.Blog, error) {
+	blog, err := BlgUseCase.Repository.GetBlog(id)
+	if err != nil {
+		return blog, errors.New("blog not found")
+	}
+	// Answer as if it did not exist so drafts can't be found by guessing IDs
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogRead, blog) {
+		return Domain.Blog{}, errors.New("blog not found")
+	}
+	return BlgUseCase.withAuthors([]Domain.Blog{blog})[0], nil
+}
+
+// withAuthors fills in the public profile of each blog's owner. A blog whose
+// owner can't be found is returned without one.
+func (BlgUseCase *BlogUseCase) withAuthors(blogs []Domain.Blog) []Domain.Blog {
+	ids := []string{}
+	for _, blog := range blogs {
+		if blog.OwnerID != "" {
+			ids = append(ids, blog.OwnerID)
+		}
+	}
+	if len(ids) == 0 {
+		return blogs
+	}
+	users, err := BlgUseCase.Users.GetUsersByIDs(ids)
+	if err != nil {
+		log.Print("failed to load blog authors: ", err)
+		return blogs
+	}
+	// Blogs kept after their owner erased the account
+	authors := map[string]*Domain.Author{Domain.DeletedUserID: {ID: Domain.DeletedUserID, Username: "Deleted user"}}
+	for _, user := range users {
+		authors[user.ID] = &Domain.Author{ID: user.ID, Username: user.Username, Avatar: user.Avatar}
+	}
+	for i := range blogs {
+		blogs[i].Author = authors[blogs[i].OwnerID]
+	}
+	return blogs
 }
 
 func (BlgUseCase *BlogUseCase) AIChatBlogUC(message Domain.ChatRequest) (*string, error) {
@@ -163,7 +349,7 @@ func (BlgUseCase *BlogUseCase) GetPopularBlogs() ([]Domain.Blog, error) {
 
 		return scoreI > scoreJ // Descending order
 	})
-	return blogs, nil
+	return BlgUseCase.withAuthors(blogs), nil
 	// return BlgUseCase.Repository.GetPopularBlogs()
 }
 
@@ -192,23 +378,203 @@ func RemoveLinesContaining(text string) string {
 	return strings.Join(cleanedLines, "")
 }
 
-func (BlgUseCase *BlogUseCase) AddToReadLater(email, id string) error {
-	blog := Domain.ReadLater{UserEmail: email, BlogIds: id}
+func (BlgUseCase *BlogUseCase) AddToReadLater(userID, id string) error {
+	blog := Domain.ReadLater{UserID: userID, BlogIds: id}
 	return BlgUseCase.Repository.StoreReadLaterBlog(blog)
 }
 
-func (BlgUseCase *BlogUseCase) FetchFromReadLater(email string) ([]Domain.Blog, error) {
-	blogIds, err := BlgUseCase.Repository.FetchReadLaterBlog(email)
+func (BlgUseCase *BlogUseCase) FetchFromReadLater(userID string) ([]Domain.Blog, error) {
+	blogIds, err := BlgUseCase.Repository.FetchReadLaterBlog(userID)
 	log.Print("blogids: ", blogIds)
 	if err != nil {
 		return nil, err
 	}
 	var Blogs []Domain.Blog
 	for _, id := range blogIds {
-		blog, _ := BlgUseCase.Repository.GetBlog(id)
+		blog, err := BlgUseCase.Repository.GetPublishedBlog(id)
+		if err != nil {
+			// skip blogs that were deleted or unpublished after being saved
+			continue
+		}
 		log.Print("blog:  ", blog)
 		Blogs = append(Blogs, blog)
 	}
 	log.Println("readlater: ", Blogs)
-	return Blogs, nil
+	return BlgUseCase.withAuthors(Blogs), nil
+}
+
+// moveTo validates a review transition before recording it
+func (BlgUseCase *BlogUseCase) moveTo(blog Domain.Blog, to string, actor Domain.User) error {
+	if blog.Status == "" {
+		blog.Status = Domain.StatusPublished
+	}
+	for _, allowed := range reviewTransitions[blog.Status] {
+		if allowed == to {
+			return BlgUseCase.recordTransition(blog, to, actor.ID)
+		}
+	}
+	return errors.New("invalid status transition from " + blog.Status + " to " + to)
+}
+
+func (BlgUseCase *BlogUseCase) recordTransition(blog Domain.Blog, to, actorID string) error {
+	if err := BlgUseCase.Repository.UpdateBlogStatus(blog.ID, to); err != nil {
+		return err
+	}
+	return BlgUseCase.Repository.StoreTransition(Domain.ReviewTransition{
+		BlogID:   blog.ID,
+		From:     blog.Status,
+		To:       to,
+		ActorID:  actorID,
+		Revision: blog.Revision,
+		Date:     time.Now(),
+	})
+}
+
+func (BlgUseCase *BlogUseCase) SubmitForReviewUC(id string, actor Domain.User) error {
+	blog, err := BlgUseCase.Repository.GetBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogSubmit, blog) {
+		return Domain.ErrForbidden
+	}
+	return BlgUseCase.moveTo(blog, Domain.StatusInReview, actor)
+}
+
+func (BlgUseCase *BlogUseCase) ReviewBlogUC(id string, actor Domain.User, decision, comment string) error {
+	var to string
+	switch decision {
+	case "approve":
+		to = Domain.StatusApproved
+	case "request_changes":
+		to = Domain.StatusChangesRequested
+		if comment == "" {
+			return errors.New("a comment is required when requesting changes")
+		}
+	default:
+		return errors.New("invalid review decision")
+	}
+	blog, err := BlgUseCase.Repository.GetBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogReview, blog) {
+		return Domain.ErrForbidden
+	}
+	if err := BlgUseCase.moveTo(blog, to, actor); err != nil {
+		return err
+	}
+	reviewed := blog
+	reviewed.Status = to
+	BlgUseCase.audit.record(actor, Domain.AuditBlogReview, "blog", id, blogSnapshot(blog), blogSnapshot(reviewed))
+	if comment == "" {
+		return nil
+	}
+	return BlgUseCase.Repository.StoreReviewComment(Domain.ReviewComment{
+		ID:         uuid.New().String(),
+		BlogID:     blog.ID,
+		Revision:   blog.Revision,
+		ReviewerID: actor.ID,
+		Comment:    comment,
+		Date:       time.Now(),
+	})
+}
+
+func (BlgUseCase *BlogUseCase) PublishBlogUC(id string, actor Domain.User) error {
+	blog, err := BlgUseCase.Repository.GetBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogPublish, blog) {
+		return Domain.ErrForbidden
+	}
+	if err := BlgUseCase.moveTo(blog, Domain.StatusPublished, actor); err != nil {
+		return err
+	}
+	published := blog
+	published.Status = Domain.StatusPublished
+	BlgUseCase.audit.record(actor, Domain.AuditBlogPublish, "blog", id, blogSnapshot(blog), blogSnapshot(published))
+	return nil
+}
+
+func (BlgUseCase *BlogUseCase) GetReviewQueueUC(actor Domain.User) ([]Domain.Blog, error) {
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogQueue, nil) {
+		return nil, Domain.ErrForbidden
+	}
+	blogs, err := BlgUseCase.Repository.GetBlogsByStatus(Domain.StatusInReview)
+	if err != nil {
+		return nil, err
+	}
+	return BlgUseCase.withAuthors(blogs), nil
+}
+
+func (BlgUseCase *BlogUseCase) GetReviewHistoryUC(id string, actor Domain.User) ([]Domain.ReviewTransition, []Domain.ReviewComment, error) {
+	blog, err := BlgUseCase.Repository.GetBlog(id)
+	if err != nil {
+		return nil, nil, errors.New("blog not found")
+	}
+	if !BlgUseCase.Policy.Can(actor, Domain.ActionBlogViewReviews, blog) {
+		return nil, nil, Domain.ErrForbidden
+	}
+	transitions, err := BlgUseCase.Repository.GetTransitions(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	comments, err := BlgUseCase.Repository.GetReviewComments(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transitions, comments, nil
+}
+
+func (BlgUC *BlogUseCase) ViewBlogUC(id string) error {
+	return BlgUC.Repository.IncrementViewCount(id)
+}
+
+func (BlgUC *BlogUseCase) AddCommentUC(id string, actor Domain.User, comment string) error {
+	if strings.TrimSpace(comment) == "" {
+		return errors.New("comment can not be empty")
+	}
+	blog, err := BlgUC.Repository.GetPublishedBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogComment, blog) {
+		return Domain.ErrForbidden
+	}
+	return BlgUC.Repository.AddComment(id, Domain.Comment{
+		ID:       uuid.New().String(),
+		AuthorID: actor.ID,
+		Text:     comment,
+		Date:     time.Now(),
+	})
+}
+
+// SetCoAuthorsUC takes the co-authors by email and stores their user IDs
+func (BlgUC *BlogUseCase) SetCoAuthorsUC(id string, actor Domain.User, coAuthors []string) error {
+	blog, err := BlgUC.Repository.GetBlog(id)
+	if err != nil {
+		return errors.New("blog not found")
+	}
+	if !BlgUC.Policy.Can(actor, Domain.ActionBlogCoAuthors, blog) {
+		return Domain.ErrForbidden
+	}
+	ids := []string{}
+	for _, email := range coAuthors {
+		if !isValidEmail(email) {
+			return errors.New("invalid co-author email")
+		}
+		user, err := BlgUC.Users.GetUserByEmail(email)
+		if err != nil || user.ID == "" || user.ID == blog.OwnerID {
+			return errors.New("invalid co-author email")
+		}
+		ids = append(ids, user.ID)
+	}
+	if err := BlgUC.Repository.UpdateCoAuthors(id, ids); err != nil {
+		return err
+	}
+	updated := blog
+	updated.CoAuthors = ids
+	BlgUC.audit.record(actor, Domain.AuditBlogCoAuthors, "blog", id, blogSnapshot(blog), blogSnapshot(updated))
+	return nil
 }
@@ -0,0 +1,151 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// How long after signing in an account without a password may change its address
+const emailChangeReauthWindow = 10 * time.Minute
+
+type EmailChangeUseCase struct {
+	repo      Domain.EmailChangeRepositoryI
+	userRepo  Domain.UserRepositoryI
+	pass_serv Domain.PasswordServiceI
+	mailer    Domain.MailerI
+}
+
+func NewEmailChangeUseCase(r Domain.EmailChangeRepositoryI, ur Domain.UserRepositoryI, ps Domain.PasswordServiceI, mailr Domain.MailerI) *EmailChangeUseCase {
+	return &EmailChangeUseCase{
+		repo:      r,
+		userRepo:  ur,
+		pass_serv: ps,
+		mailer:    mailr,
+	}
+}
+
+// RequestEmailChangeUC sends a confirmation link to the current and the new
+// address. Accounts with a password have to enter it again, the others must
+// have signed in within emailChangeReauthWindow.
+func (ecUC *EmailChangeUseCase) RequestEmailChangeUC(user Domain.User, sessionID, newEmail, password string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if !isValidEmail(newEmail) {
+		return errors.New("invalid email")
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.New("new email is the same as the current one")
+	}
+	if user.Password != "" && !ecUC.pass_serv.Compare(user.Password, password) {
+		return errors.New("invalid password")
+	}
+	if user.Password == "" && !ecUC.signedInRecently(user.ID, sessionID) {
+		return errors.New("sign in again to change your email")
+	}
+	if ecUC.userRepo.CheckExistence(newEmail) == nil {
+		return errors.New("email already exists in database")
+	}
+
+	oldToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	newToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	change := Domain.EmailChange{
+		ID:           uuid.New().String(),
+		Email:        user.Email,
+		NewEmail:     newEmail,
+		OldTokenHash: hashToken(oldToken),
+		NewTokenHash: hashToken(newToken),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(emailChangeTTL),
+	}
+	if err := ecUC.repo.StoreEmailChange(change); err != nil {
+		return err
+	}
+	for to, token := range map[string]string{user.Email: oldToken, newEmail: newToken} {
+		if err := ecUC.mailer.SendEmailChangeEmail(to, newEmail, token); err != nil {
+			log.Print(err.Error())
+			return errors.New("error while sending confirmation email")
+		}
+	}
+	return nil
+}
+
+// signedInRecently tells whether the session belongs to the user and was
+// started, not just refreshed, a moment ago. Tokens from before sessions
+// existed have no session and never count as recent.
+func (ecUC *EmailChangeUseCase) signedInRecently(userID, sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	session, err := ecUC.userRepo.GetSession(sessionID)
+	if err != nil || session.UserID != userID {
+		return false
+	}
+	return time.Since(session.CreatedAt) <= emailChangeReauthWindow
+}
+
+// CheckEmailChangeUC looks up the change a link belongs to without confirming
+// it, so mail scanners and link previews that open it confirm nothing
+func (ecUC *EmailChangeUseCase) CheckEmailChangeUC(token string) (Domain.EmailChange, error) {
+	change, err := ecUC.repo.GetEmailChange(hashToken(token))
+	if err != nil || time.Now().After(change.ExpiresAt) {
+		return Domain.EmailChange{}, errors.New("invalid or expired link")
+	}
+	return change, nil
+}
+
+// ConfirmEmailChangeUC confirms the address the link was sent to and applies
+// the change once both are confirmed
+func (ecUC *EmailChangeUseCase) ConfirmEmailChangeUC(token string) (Domain.EmailChange, error) {
+	change, err := ecUC.CheckEmailChangeUC(token)
+	if err != nil {
+		return Domain.EmailChange{}, err
+	}
+	tokenHash := hashToken(token)
+	change, err = ecUC.repo.ConfirmEmailChange(change.ID, tokenHash == change.OldTokenHash)
+	if err != nil {
+		return Domain.EmailChange{}, err
+	}
+	if !change.OldConfirmed || !change.NewConfirmed {
+		return change, nil
+	}
+	return change, ecUC.apply(change)
+}
+
+func (ecUC *EmailChangeUseCase) apply(change Domain.EmailChange) error {
+	// The address may have been registered while the links were on their way
+	if ecUC.userRepo.CheckExistence(change.NewEmail) == nil {
+		if err := ecUC.repo.DeleteEmailChange(change.Email); err != nil {
+			return err
+		}
+		return errors.New("email already exists in database")
+	}
+	user, err := ecUC.userRepo.GetUserByEmail(change.Email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	// Tokens name the old address, every device signs in again
+	if err := ecUC.userRepo.RevokeSessions(user.ID, ""); err != nil {
+		return err
+	}
+	if err := ecUC.userRepo.RenameEmail(change.Email, change.NewEmail); err != nil {
+		return err
+	}
+	return ecUC.repo.DeleteEmailChange(change.Email)
+}
+
+func (ecUC *EmailChangeUseCase) CancelEmailChangeUC(email string) error {
+	return ecUC.repo.DeleteEmailChange(email)
+}
@@ -0,0 +1,132 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	loginBaseDelay = time.Second
+	loginMaxDelay  = 5 * time.Minute
+	// Failures are forgotten after a quiet loginFailureWindow
+	loginFailureWindow = time.Hour
+	loginLockout       = 30 * time.Minute
+)
+
+// loginLimit is how many failures a key gets for free before every further
+// attempt has to wait, and how many lock it
+type loginLimit struct {
+	free int
+	lock int
+}
+
+var (
+	accountLimit = loginLimit{free: 3, lock: 10}
+	// An address can be shared by many users, so it gets more room
+	ipLimit = loginLimit{free: 20, lock: 100}
+)
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginThrottle refuses a login while the account or the address is
+// locked or backing off
+func (uc UserUsecase) checkLoginThrottle(email, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	for key, limit := range map[string]loginLimit{accountKey(email): accountLimit, ipKey(ip): ipLimit} {
+		attempts, err := uc.attempts.GetAttempts(key)
+		if err != nil {
+			return err
+		}
+		if now.Before(attempts.LockedUntil) {
+			wait = max(wait, attempts.LockedUntil.Sub(now))
+			continue
+		}
+		if now.Sub(attempts.LastFailure) > loginFailureWindow {
+			continue
+		}
+		if next := attempts.LastFailure.Add(limit.delay(attempts.Failures)); now.Before(next) {
+			wait = max(wait, next.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return &Domain.ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// delay doubles the wait for every failure past the free ones
+func (l loginLimit) delay(failures int) time.Duration {
+	if failures < l.free {
+		return 0
+	}
+	delay := loginBaseDelay
+	for i := l.free; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, loginMaxDelay)
+}
+
+// loginFailed counts a failure for the account and the address and locks
+// whichever went over its limit. The owner of a locked account gets an email.
+func (uc UserUsecase) loginFailed(email, ip string, user *Domain.User) {
+	now := time.Now()
+	locked, err := uc.recordFailure(accountKey(email), accountLimit, now)
+	if err != nil {
+		log.Print("failed to record login failure: ", err)
+	}
+	if locked && user != nil {
+		go func() {
+			if err := uc.mailer.SendAccountLockedEmail(user.Email, now.Add(loginLockout)); err != nil {
+				log.Print("failed to send account locked email: ", err)
+			}
+		}()
+	}
+	if _, err := uc.recordFailure(ipKey(ip), ipLimit, now); err != nil {
+		log.Print("failed to record login failure: ", err)
+	}
+}
+
+// recordFailure reports whether the failure locked the key
+func (uc UserUsecase) recordFailure(key string, limit loginLimit, now time.Time) (bool, error) {
+	attempts, err := uc.attempts.GetAttempts(key)
+	if err != nil {
+		return false, err
+	}
+	if attempts.Failures > 0 && now.Sub(attempts.LastFailure) > loginFailureWindow {
+		if err := uc.attempts.Reset(key); err != nil {
+			return false, err
+		}
+	}
+	attempts, err = uc.attempts.RecordFailure(key, now)
+	if err != nil || attempts.Failures < limit.lock {
+		return false, err
+	}
+	log.Printf("logins locked for %s", key)
+	return true, uc.attempts.Lock(key, now.Add(loginLockout))
+}
+
+// UnlockAccountUC clears the failed logins of an account, lifting a lockout
+func (uc UserUsecase) UnlockAccountUC(actor Domain.User, id string) error {
+	user, err := uc.repo.GetUserByID(id)
+	if err != nil {
+		// The unlock route used to take the email
+		if user, err = uc.repo.GetUserByEmail(id); err != nil {
+			return errors.New("user not found")
+		}
+	}
+	if err := uc.attempts.Reset(accountKey(user.Email)); err != nil {
+		return err
+	}
+	uc.audit.record(actor, Domain.AuditUserUnlock, "user", user.ID, nil, nil)
+	return nil
+}
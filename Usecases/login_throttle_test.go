@@ -0,0 +1,314 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"blog_api/Repositories"
+	"errors"
+	"testing"
+	"time"
+)
+
+// lockMailer records the account locked emails, the other mails are not
+// expected from the throttle
+type lockMailer struct {
+	Domain.MailerI
+	sent chan lockedMail
+}
+
+type lockedMail struct {
+	to    string
+	until time.Time
+}
+
+func (m lockMailer) SendAccountLockedEmail(toEmail string, until time.Time) error {
+	m.sent <- lockedMail{to: toEmail, until: until}
+	return nil
+}
+
+func newThrottleUsecase() (UserUsecase, lockMailer) {
+	mailer := lockMailer{sent: make(chan lockedMail, 10)}
+	return UserUsecase{attempts: Repositories.NewMemoryLoginAttemptRepository(), mailer: mailer}, mailer
+}
+
+// throttled returns how long the login has to wait, zero when it may go ahead
+func throttled(t *testing.T, uc UserUsecase, email, ip string) time.Duration {
+	t.Helper()
+	err := uc.checkLoginThrottle(email, ip)
+	if err == nil {
+		return 0
+	}
+	var throttleErr *Domain.ThrottledError
+	if !errors.As(err, &throttleErr) {
+		t.Fatalf("checkLoginThrottle: %v", err)
+	}
+	return throttleErr.RetryAfter
+}
+
+func TestLoginLimitDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    loginLimit
+		failures int
+		want     time.Duration
+	}{
+		{"account no failures", accountLimit, 0, 0},
+		{"account last free failure", accountLimit, 2, 0},
+		{"account first delayed", accountLimit, 3, time.Second},
+		{"account doubles", accountLimit, 4, 2 * time.Second},
+		{"account doubles again", accountLimit, 6, 8 * time.Second},
+		{"account just under the cap", accountLimit, 11, 256 * time.Second},
+		{"account capped", accountLimit, 12, loginMaxDelay},
+		{"account far past the cap", accountLimit, 1000, loginMaxDelay},
+		{"ip last free failure", ipLimit, 19, 0},
+		{"ip first delayed", ipLimit, 20, time.Second},
+		{"ip doubles", ipLimit, 23, 8 * time.Second},
+		{"ip capped", ipLimit, 99, loginMaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limit.delay(tt.failures); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordFailureLockout(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		limit loginLimit
+	}{
+		{"account", accountKey("a@example.com"), accountLimit},
+		{"ip", ipKey("203.0.113.7"), ipLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newThrottleUsecase()
+			now := time.Now()
+			for i := 1; i < tt.limit.lock; i++ {
+				locked, err := uc.recordFailure(tt.key, tt.limit, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if locked {
+					t.Fatalf("locked after %d failures, want %d", i, tt.limit.lock)
+				}
+			}
+			locked, err := uc.recordFailure(tt.key, tt.limit, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !locked {
+				t.Fatalf("not locked after %d failures", tt.limit.lock)
+			}
+			attempts, _ := uc.attempts.GetAttempts(tt.key)
+			if !attempts.LockedUntil.Equal(now.Add(loginLockout)) {
+				t.Errorf("locked until %v, want %v", attempts.LockedUntil, now.Add(loginLockout))
+			}
+			if attempts.Failures != 0 {
+				t.Errorf("failures = %d after the lock, want the count to start over", attempts.Failures)
+			}
+		})
+	}
+}
+
+func TestRecordFailureForgetsOldFailures(t *testing.T) {
+	uc, _ := newThrottleUsecase()
+	key := accountKey("a@example.com")
+	old := time.Now().Add(-loginFailureWindow - time.Minute)
+	for i := 0; i < accountLimit.lock-1; i++ {
+		if _, err := uc.recordFailure(key, accountLimit, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locked, err := uc.recordFailure(key, accountLimit, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		t.Error("failures older than the window counted towards the lock")
+	}
+	if attempts, _ := uc.attempts.GetAttempts(key); attempts.Failures != 1 {
+		t.Errorf("failures = %d, want 1", attempts.Failures)
+	}
+}
+
+func TestCheckLoginThrottleCounting(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  []throttleLogin
+		check     throttleLogin
+		throttled bool
+	}{
+		{
+			name:     "free account failures",
+			failures: repeatLogin(throttleLogin{"a@example.com", "198.51.100.1"}, accountLimit.free-1),
+			check:    throttleLogin{"a@example.com", "198.51.100.1"},
+		},
+		{
+			name:      "account backs off",
+			failures:  repeatLogin(throttleLogin{"a@example.com", "198.51.100.1"}, accountLimit.free),
+			check:     throttleLogin{"a@example.com", "198.51.100.1"},
+			throttled: true,
+		},
+		{
+			name:      "account counted across addresses",
+			failures:  []throttleLogin{{"a@example.com", "198.51.100.1"}, {"a@example.com", "198.51.100.2"}, {"a@example.com", "198.51.100.3"}},
+			check:     throttleLogin{"a@example.com", "198.51.100.4"},
+			throttled: true,
+		},
+		{
+			name:      "account key ignores case and spaces",
+			failures:  []throttleLogin{{"A@Example.com", "198.51.100.1"}, {" a@example.com", "198.51.100.1"}, {"a@EXAMPLE.COM ", "198.51.100.1"}},
+			check:     throttleLogin{"a@example.com", "198.51.100.9"},
+			throttled: true,
+		},
+		{
+			name:     "other accounts on the address are not held back",
+			failures: repeatLogin(throttleLogin{"a@example.com", "198.51.100.1"}, accountLimit.free),
+			check:    throttleLogin{"b@example.com", "198.51.100.1"},
+		},
+		{
+			name:     "free address failures",
+			failures: spreadLogins("198.51.100.1", ipLimit.free-1),
+			check:    throttleLogin{"new@example.com", "198.51.100.1"},
+		},
+		{
+			name:      "address backs off for every account",
+			failures:  spreadLogins("198.51.100.1", ipLimit.free),
+			check:     throttleLogin{"new@example.com", "198.51.100.1"},
+			throttled: true,
+		},
+		{
+			name:     "other addresses are not held back",
+			failures: spreadLogins("198.51.100.1", ipLimit.free),
+			check:    throttleLogin{"new@example.com", "198.51.100.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newThrottleUsecase()
+			for _, f := range tt.failures {
+				uc.loginFailed(f.email, f.ip, nil)
+			}
+			wait := throttled(t, uc, tt.check.email, tt.check.ip)
+			if tt.throttled && (wait <= 0 || wait > loginBaseDelay) {
+				t.Errorf("wait = %v, want up to %v", wait, loginBaseDelay)
+			}
+			if !tt.throttled && wait != 0 {
+				t.Errorf("throttled for %v, want no wait", wait)
+			}
+		})
+	}
+}
+
+type throttleLogin struct{ email, ip string }
+
+func repeatLogin(login throttleLogin, n int) []throttleLogin {
+	logins := make([]throttleLogin, n)
+	for i := range logins {
+		logins[i] = login
+	}
+	return logins
+}
+
+// spreadLogins fails n logins from one address, each on its own account
+func spreadLogins(ip string, n int) []throttleLogin {
+	logins := make([]throttleLogin, n)
+	for i := range logins {
+		logins[i].email = string(rune('a'+i)) + "@example.com"
+		logins[i].ip = ip
+	}
+	return logins
+}
+
+func TestCheckLoginThrottleLocked(t *testing.T) {
+	uc, _ := newThrottleUsecase()
+	for i := 0; i < accountLimit.lock; i++ {
+		uc.loginFailed("a@example.com", "198.51.100.1", nil)
+	}
+	// The lock starts the count over, so only the lock holds the login back
+	wait := throttled(t, uc, "a@example.com", "198.51.100.2")
+	if wait <= loginLockout-time.Minute || wait > loginLockout {
+		t.Errorf("wait = %v, want about %v", wait, loginLockout)
+	}
+}
+
+func TestLoginThrottleReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+	}{
+		{"backing off", accountLimit.free + 2},
+		{"locked", accountLimit.lock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newThrottleUsecase()
+			for i := 0; i < tt.failures; i++ {
+				uc.loginFailed("a@example.com", "198.51.100.1", nil)
+			}
+			if throttled(t, uc, "a@example.com", "198.51.100.1") == 0 {
+				t.Fatal("not throttled before the reset")
+			}
+			if err := uc.attempts.Reset(accountKey("a@example.com")); err != nil {
+				t.Fatal(err)
+			}
+			if wait := throttled(t, uc, "a@example.com", "198.51.100.1"); wait != 0 {
+				t.Errorf("throttled for %v after the reset", wait)
+			}
+			attempts, _ := uc.attempts.GetAttempts(accountKey("a@example.com"))
+			if attempts.Failures != 0 || !attempts.LockedUntil.IsZero() {
+				t.Errorf("attempts after the reset = %+v", attempts)
+			}
+		})
+	}
+}
+
+func TestLoginFailedLockoutEmail(t *testing.T) {
+	user := &Domain.User{ID: "u1", Email: "owner@example.com"}
+	tests := []struct {
+		name     string
+		user     *Domain.User
+		failures int
+		mailed   bool
+	}{
+		{"below the threshold", user, accountLimit.lock - 1, false},
+		{"at the threshold", user, accountLimit.lock, true},
+		{"unknown account", nil, accountLimit.lock, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, mailer := newThrottleUsecase()
+			start := time.Now()
+			for i := 0; i < tt.failures; i++ {
+				uc.loginFailed("Owner@example.com", "198.51.100.1", tt.user)
+			}
+			if !tt.mailed {
+				select {
+				case mail := <-mailer.sent:
+					t.Errorf("unexpected lock email to %s", mail.to)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case mail := <-mailer.sent:
+				if mail.to != user.Email {
+					t.Errorf("mailed %s, want %s", mail.to, user.Email)
+				}
+				if mail.until.Before(start.Add(loginLockout)) || mail.until.After(time.Now().Add(loginLockout)) {
+					t.Errorf("locked until %v, want %v from now", mail.until, loginLockout)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no lock email sent")
+			}
+			select {
+			case <-mailer.sent:
+				t.Error("lock email sent more than once")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
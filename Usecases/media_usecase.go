@@ -0,0 +1,378 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Content types accepted for upload and the extension used when storing them
+var allowedMediaTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+type MediaUseCase struct {
+	repo      Domain.MediaRepositoryI
+	blogRepo  Domain.BlogRepositoryI
+	userRepo  Domain.UserRepositoryI
+	store     Domain.BlobStore
+	processor Domain.ImageProcessorI
+	policy    Domain.PolicyI
+	maxSize   int64
+	quota     int64
+	baseURL   string
+	jobs      chan string
+}
+
+func NewMediaUseCase(r Domain.MediaRepositoryI, br Domain.BlogRepositoryI, ur Domain.UserRepositoryI, store Domain.BlobStore, ip Domain.ImageProcessorI, pl Domain.PolicyI, maxSize, quota int64, baseURL string) *MediaUseCase {
+	return &MediaUseCase{
+		repo:      r,
+		blogRepo:  br,
+		userRepo:  ur,
+		store:     store,
+		processor: ip,
+		policy:    pl,
+		maxSize:   maxSize,
+		quota:     quota,
+		baseURL:   baseURL,
+		jobs:      make(chan string, 100),
+	}
+}
+
+func (mu *MediaUseCase) UploadMediaUC(owner, filename string, size int64, file io.Reader) (Domain.Media, error) {
+	if size <= 0 {
+		return Domain.Media{}, errors.New("empty file")
+	}
+	if size > mu.maxSize {
+		return Domain.Media{}, errors.New("file too large")
+	}
+	// Read one byte past the limit so a lying size header is still caught
+	data, err := io.ReadAll(io.LimitReader(file, mu.maxSize+1))
+	if err != nil {
+		return Domain.Media{}, err
+	}
+	if int64(len(data)) > mu.maxSize {
+		return Domain.Media{}, errors.New("file too large")
+	}
+
+	// Trust the file content rather than the name or client supplied header
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedMediaTypes[contentType]
+	if !ok {
+		return Domain.Media{}, errors.New("unsupported file type")
+	}
+	// Nothing with location or camera details is ever stored, let alone served
+	if isImage(contentType) {
+		if data, err = mu.processor.Sanitize(data, contentType); err != nil {
+			return Domain.Media{}, err
+		}
+	}
+
+	id := uuid.New().String()
+	media := Domain.Media{
+		ID:          id,
+		OwnerID:     owner,
+		Key:         "uploads/" + id + ext,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		URL:         mu.baseURL + "/media/" + id,
+		Date:        time.Now(),
+	}
+	// The record goes in before the quota is checked, so uploads running at the
+	// same time count each other. One that ends up over the quota takes its
+	// record back out, two racing for the last space may both be refused.
+	if err := mu.repo.StoreMedia(media); err != nil {
+		return Domain.Media{}, err
+	}
+	used, err := mu.usedStorage(owner)
+	if err != nil {
+		mu.discard(media)
+		return Domain.Media{}, err
+	}
+	if used > mu.quota {
+		mu.discard(media)
+		return Domain.Media{}, errors.New("storage quota exceeded")
+	}
+	if err := mu.store.Put(media.Key, data, contentType); err != nil {
+		mu.discard(media)
+		return Domain.Media{}, err
+	}
+	if isImage(contentType) {
+		mu.enqueue(media.ID)
+	}
+	return media, nil
+}
+
+// usedStorage adds up the size of everything the owner uploaded
+func (mu *MediaUseCase) usedStorage(owner string) (int64, error) {
+	existing, err := mu.repo.GetUserMedia(owner)
+	if err != nil {
+		return 0, err
+	}
+	var used int64
+	for _, m := range existing {
+		used += m.Size
+	}
+	return used, nil
+}
+
+// discard removes the record of an upload that failed. The upload's own error
+// is what the caller sees, a failure here is only logged and leaves a record
+// without a file for the orphan cleanup.
+func (mu *MediaUseCase) discard(media Domain.Media) {
+	if err := mu.repo.DeleteMedia(media.ID); err != nil {
+		log.Printf("failed to remove the record of failed upload %s: %v", media.ID, err)
+	}
+}
+
+func isImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+func (mu *MediaUseCase) enqueue(id string) {
+	select {
+	case mu.jobs <- id:
+	default:
+		log.Printf("image queue full, processing %s out of band", id)
+		go mu.runJob(id)
+	}
+}
+
+// RunImageWorker processes queued uploads until the queue is closed
+func (mu *MediaUseCase) RunImageWorker() {
+	for id := range mu.jobs {
+		mu.runJob(id)
+	}
+}
+
+func (mu *MediaUseCase) runJob(id string) {
+	if err := mu.ProcessImageUC(id); err != nil {
+		log.Printf("failed to process image %s: %v", id, err)
+	}
+}
+
+// ProcessImageUC stores the resized variants of an uploaded image and
+// refreshes any cover or avatar that already points at it
+func (mu *MediaUseCase) ProcessImageUC(id string) error {
+	media, err := mu.repo.GetMedia(id)
+	if err != nil {
+		return err
+	}
+	if !isImage(media.ContentType) {
+		return errors.New("media is not an image")
+	}
+	data, err := mu.store.Get(media.Key)
+	if err != nil {
+		return err
+	}
+	processed, err := mu.processor.Process(data, media.ContentType)
+	if err != nil {
+		return err
+	}
+
+	variants := []Domain.ImageVariant{}
+	for _, v := range processed.Variants {
+		name := strconv.Itoa(v.Width) + v.Extension
+		variant := Domain.ImageVariant{
+			Name:        name,
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.ContentType,
+			Key:         "variants/" + media.ID + "/" + name,
+			URL:         media.URL + "/" + name,
+			Size:        int64(len(v.Data)),
+		}
+		if err := mu.store.Put(variant.Key, v.Data, v.ContentType); err != nil {
+			return err
+		}
+		variants = append(variants, variant)
+	}
+
+	media.Width = processed.Width
+	media.Height = processed.Height
+	media.BlurHash = processed.BlurHash
+	media.Variants = variants
+	media.Processed = true
+	if err := mu.repo.UpdateMedia(media); err != nil {
+		return err
+	}
+	image := toImage(media)
+	if err := mu.blogRepo.RefreshCoverImage(*image); err != nil {
+		return err
+	}
+	return mu.userRepo.RefreshAvatar(*image)
+}
+
+func toImage(media Domain.Media) *Domain.Image {
+	return &Domain.Image{
+		MediaID:  media.ID,
+		URL:      media.URL,
+		Width:    media.Width,
+		Height:   media.Height,
+		BlurHash: media.BlurHash,
+		Variants: media.Variants,
+	}
+}
+
+// imageFor checks that the actor may use the upload as a cover or avatar
+func (mu *MediaUseCase) imageFor(mediaID string, actor Domain.User) (*Domain.Image, error) {
+	media, err := mu.repo.GetMedia(mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if !mu.policy.Can(actor, Domain.ActionMediaUse, media) {
+		return nil, Domain.ErrForbidden
+	}
+	if !isImage(media.ContentType) {
+		return nil, errors.New("media is not an image")
+	}
+	return toImage(media), nil
+}
+
+func (mu *MediaUseCase) SetBlogCoverUC(blogID, mediaID string, actor Domain.User) (*Domain.Image, error) {
+	blog, err := mu.blogRepo.GetBlog(blogID)
+	if err != nil {
+		return nil, errors.New("blog not found")
+	}
+	if !mu.policy.Can(actor, Domain.ActionBlogCover, blog) {
+		return nil, Domain.ErrForbidden
+	}
+	var cover *Domain.Image
+	if mediaID != "" {
+		if cover, err = mu.imageFor(mediaID, actor); err != nil {
+			return nil, err
+		}
+	}
+	return cover, mu.blogRepo.UpdateBlogCover(blogID, cover)
+}
+
+func (mu *MediaUseCase) SetAvatarUC(mediaID string, actor Domain.User) (*Domain.Image, error) {
+	var avatar *Domain.Image
+	var err error
+	if mediaID != "" {
+		if avatar, err = mu.imageFor(mediaID, actor); err != nil {
+			return nil, err
+		}
+	}
+	return avatar, mu.userRepo.UpdateUserAvatar(actor.ID, avatar)
+}
+
+func (mu *MediaUseCase) GetMediaVariantUC(id, name string) (Domain.ImageVariant, []byte, error) {
+	media, err := mu.repo.GetMedia(id)
+	if err != nil {
+		return Domain.ImageVariant{}, nil, err
+	}
+	for _, variant := range media.Variants {
+		if variant.Name == name {
+			data, err := mu.store.Get(variant.Key)
+			return variant, data, err
+		}
+	}
+	return Domain.ImageVariant{}, nil, errors.New("media not found")
+}
+
+func (mu *MediaUseCase) GetMediaUC(id string) (Domain.Media, []byte, error) {
+	media, err := mu.repo.GetMedia(id)
+	if err != nil {
+		return media, nil, err
+	}
+	data, err := mu.store.Get(media.Key)
+	if err != nil {
+		return media, nil, err
+	}
+	return media, data, nil
+}
+
+func (mu *MediaUseCase) ListMediaUC(owner string) ([]Domain.Media, error) {
+	return mu.repo.GetUserMedia(owner)
+}
+
+func (mu *MediaUseCase) DeleteMediaUC(id string, actor Domain.User) error {
+	media, err := mu.repo.GetMedia(id)
+	if err != nil {
+		return err
+	}
+	if !mu.policy.Can(actor, Domain.ActionMediaDelete, media) {
+		return Domain.ErrForbidden
+	}
+	return mu.remove(media)
+}
+
+// CollectOrphansUC removes uploads older than the grace period that no blog references
+func (mu *MediaUseCase) CollectOrphansUC(gracePeriod time.Duration) (int, error) {
+	candidates, err := mu.repo.GetMediaBefore(time.Now().Add(-gracePeriod))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, media := range candidates {
+		referenced, err := mu.blogRepo.ReferencesMedia(media.ID, media.URL)
+		if err != nil {
+			return removed, err
+		}
+		if !referenced {
+			referenced, err = mu.userRepo.HasAvatar(media.ID)
+			if err != nil {
+				return removed, err
+			}
+		}
+		if referenced {
+			continue
+		}
+		if err := mu.remove(media); err != nil {
+			log.Printf("failed to remove orphaned media %s: %v", media.ID, err)
+			continue
+		}
+		removed += 1
+	}
+	return removed, nil
+}
+
+// ReleaseUploadsUC clears out the uploads of an erased account. Those a blog
+// still shows are handed to the deleted user, the rest are removed.
+func (mu *MediaUseCase) ReleaseUploadsUC(ownerID string) error {
+	uploads, err := mu.repo.GetUserMedia(ownerID)
+	if err != nil {
+		return err
+	}
+	for _, media := range uploads {
+		referenced, err := mu.blogRepo.ReferencesMedia(media.ID, media.URL)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			media.OwnerID = Domain.DeletedUserID
+			err = mu.repo.UpdateMedia(media)
+		} else {
+			err = mu.remove(media)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mu *MediaUseCase) remove(media Domain.Media) error {
+	for _, variant := range media.Variants {
+		if err := mu.store.Delete(variant.Key); err != nil {
+			return err
+		}
+	}
+	if err := mu.store.Delete(media.Key); err != nil {
+		return err
+	}
+	return mu.repo.DeleteMedia(media.ID)
+}
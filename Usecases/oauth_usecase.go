@@ -0,0 +1,353 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeTTL = 10 * time.Minute
+
+type OAuthUseCase struct {
+	repo     Domain.OAuthRepositoryI
+	userRepo Domain.UserRepositoryI
+	jwtServ  Domain.JwtServI
+	revoked  Domain.RevocationListI
+}
+
+func NewOAuthUseCase(r Domain.OAuthRepositoryI, ur Domain.UserRepositoryI, jt Domain.JwtServI, rl Domain.RevocationListI) *OAuthUseCase {
+	return &OAuthUseCase{
+		repo:     r,
+		userRepo: ur,
+		jwtServ:  jt,
+		revoked:  rl,
+	}
+}
+
+func oauthError(code, description string) error {
+	return &Domain.OAuthError{Code: code, Description: description}
+}
+
+func (oaUC *OAuthUseCase) issuer() tokenIssuer {
+	return tokenIssuer{repo: oaUC.userRepo, jwtServ: oaUC.jwtServ}
+}
+
+// RegisterClientUC returns the client and its secret, which is only shown once.
+// Public clients get no secret.
+func (oaUC *OAuthUseCase) RegisterClientUC(owner string, client Domain.OAuthClient) (Domain.OAuthClient, string, error) {
+	client.Name = strings.TrimSpace(client.Name)
+	if client.Name == "" || len(client.Name) > 100 {
+		return client, "", errors.New("client name must be between 1 and 100 characters")
+	}
+	if len(client.RedirectURIs) == 0 || len(client.RedirectURIs) > 10 {
+		return client, "", errors.New("between 1 and 10 redirect uris are required")
+	}
+	for _, uri := range client.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return client, "", errors.New("invalid redirect uri " + uri)
+		}
+	}
+	if len(client.Scopes) == 0 {
+		return client, "", errors.New("at least one scope is required")
+	}
+	for _, scope := range client.Scopes {
+		if !slices.Contains(Domain.Scopes, scope) {
+			return client, "", errors.New("unknown scope " + scope)
+		}
+	}
+
+	client.ID = uuid.New().String()
+	client.OwnerID = owner
+	client.CreatedAt = time.Now()
+	secret := ""
+	if !client.Public {
+		var err error
+		if secret, err = randomToken(); err != nil {
+			return client, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	if err := oaUC.repo.StoreClient(client); err != nil {
+		return client, "", err
+	}
+	return client, secret, nil
+}
+
+// Redirects must be absolute https urls, plain http is only allowed back to the same machine
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	host := u.Hostname()
+	return u.Scheme == "https" || (u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1"))
+}
+
+func (oaUC *OAuthUseCase) ListClientsUC(owner string) ([]Domain.OAuthClient, error) {
+	return oaUC.repo.GetClients(owner)
+}
+
+// DeleteClientUC removes the client and signs every user out of it
+func (oaUC *OAuthUseCase) DeleteClientUC(owner, id string) error {
+	if err := oaUC.repo.DeleteClient(id, owner); err != nil {
+		return err
+	}
+	return oaUC.userRepo.RevokeClientSessions(id)
+}
+
+// ConsentUC checks an authorization request and returns what the user is asked to allow
+func (oaUC *OAuthUseCase) ConsentUC(req Domain.AuthorizeRequest) (Domain.OAuthClient, []string, error) {
+	client, _, scopes, err := oaUC.checkAuthorizeRequest(req)
+	return client, scopes, err
+}
+
+// AuthorizeUC records the user's decision and returns where to send the user back to
+func (oaUC *OAuthUseCase) AuthorizeUC(user Domain.User, req Domain.AuthorizeRequest, approve bool) (string, error) {
+	client, redirectURI, scopes, err := oaUC.checkAuthorizeRequest(req)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	if !approve {
+		params.Set("error", "access_denied")
+		return withQuery(redirectURI, params), nil
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	err = oaUC.repo.StoreCode(Domain.OAuthCode{
+		CodeHash:         hashToken(code),
+		ClientID:         client.ID,
+		UserID:           user.ID,
+		RedirectURI:      redirectURI,
+		RedirectURIGiven: req.RedirectURI != "",
+		Scopes:           scopes,
+		CodeChallenge:    req.CodeChallenge,
+		ExpiresAt:        time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	params.Set("code", code)
+	return withQuery(redirectURI, params), nil
+}
+
+// checkAuthorizeRequest resolves the redirect uri and the scopes being asked
+// for. PKCE with S256 is required from every client.
+func (oaUC *OAuthUseCase) checkAuthorizeRequest(req Domain.AuthorizeRequest) (Domain.OAuthClient, string, []string, error) {
+	client, err := oaUC.repo.GetClient(req.ClientID)
+	if err != nil {
+		return client, "", nil, oauthError("invalid_client", "unknown client")
+	}
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return client, "", nil, oauthError("invalid_request", "redirect uri is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return client, "", nil, oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		return client, "", nil, oauthError("invalid_request", "a S256 PKCE code challenge is required")
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return client, "", nil, oauthError("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	return client, redirectURI, scopes, nil
+}
+
+func withQuery(raw string, params url.Values) string {
+	u, _ := url.Parse(raw)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// TokenUC handles the authorization_code and refresh_token grants
+func (oaUC *OAuthUseCase) TokenUC(req Domain.TokenRequest, device Domain.DeviceInfo) (map[string]string, error) {
+	client, err := oaUC.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch req.GrantType {
+	case "authorization_code":
+		return oaUC.exchangeCode(client, req, device)
+	case "refresh_token":
+		tokens, err := oaUC.issuer().refresh(req.RefreshToken, client.ID, device)
+		if err != nil {
+			return nil, oauthError("invalid_grant", err.Error())
+		}
+		return oaUC.withExpiry(tokens), nil
+	default:
+		return nil, oauthError("unsupported_grant_type", "grant type must be authorization_code or refresh_token")
+	}
+}
+
+func (oaUC *OAuthUseCase) exchangeCode(client Domain.OAuthClient, req Domain.TokenRequest, device Domain.DeviceInfo) (map[string]string, error) {
+	code, err := oaUC.repo.ConsumeCode(hashToken(req.Code))
+	if err != nil || code.ClientID != client.ID || time.Now().After(code.ExpiresAt) {
+		return nil, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+	// The redirect uri may only be left out when the authorization request left
+	// it out too (RFC 6749 section 4.1.3)
+	if (code.RedirectURIGiven || req.RedirectURI != "") && code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "redirect uri does not match the authorization request")
+	}
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		return nil, oauthError("invalid_grant", "code verifier does not match the code challenge")
+	}
+	user, err := oaUC.userRepo.GetUserByID(code.UserID)
+	if err != nil {
+		return nil, oauthError("invalid_grant", "user no longer exists")
+	}
+	tokens, err := oaUC.issuer().startSession(*user, device, client.ID, code.Scopes)
+	var suspended *Domain.SuspendedError
+	if errors.As(err, &suspended) {
+		return nil, oauthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	tokens["scope"] = strings.Join(code.Scopes, " ")
+	return oaUC.withExpiry(tokens), nil
+}
+
+// withExpiry adds expires_in, read from the access token itself
+func (oaUC *OAuthUseCase) withExpiry(tokens map[string]string) map[string]string {
+	if token, err := oaUC.jwtServ.ParseToken(tokens["access_token"]); err == nil {
+		if exp, ok := token.Claims.(jwt.MapClaims)["exp"].(float64); ok {
+			tokens["expires_in"] = strconv.FormatInt(int64(exp)-time.Now().Unix(), 10)
+		}
+	}
+	return tokens
+}
+
+// authenticateClient checks the secret of confidential clients. Public clients
+// are identified by their id and protected by PKCE instead.
+func (oaUC *OAuthUseCase) authenticateClient(id, secret string) (Domain.OAuthClient, error) {
+	client, err := oaUC.repo.GetClient(id)
+	if err != nil {
+		return client, oauthError("invalid_client", "unknown client")
+	}
+	if client.Public {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return client, oauthError("invalid_client", "invalid client credentials")
+	}
+	return client, nil
+}
+
+// RevokeUC follows RFC 7009: unknown tokens and tokens of other clients are
+// ignored without an error
+func (oaUC *OAuthUseCase) RevokeUC(clientID, clientSecret, raw string) error {
+	client, err := oaUC.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	token, err := oaUC.jwtServ.ParseToken(raw)
+	if err != nil {
+		return nil
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	switch claims["type"] {
+	case "refresh":
+		stored, err := oaUC.userRepo.GetRefreshToken(hashToken(raw))
+		if err != nil {
+			return nil
+		}
+		session, err := oaUC.userRepo.GetSession(stored.FamilyID)
+		if err != nil || session.ClientID != client.ID {
+			return nil
+		}
+		return oaUC.userRepo.RevokeSession(session.ID)
+	case "access":
+		jti, _ := claims["jti"].(string)
+		email, _ := claims["email"].(string)
+		exp, _ := claims["exp"].(float64)
+		if claims["client_id"] != client.ID || jti == "" {
+			return nil
+		}
+		return oaUC.revoked.Revoke(Domain.RevokedToken{JTI: jti, Email: email, ExpiresAt: time.Unix(int64(exp), 0)})
+	}
+	return nil
+}
+
+// IntrospectUC follows RFC 7662. A client only learns about its own tokens.
+func (oaUC *OAuthUseCase) IntrospectUC(clientID, clientSecret, raw string) (Domain.Introspection, error) {
+	inactive := Domain.Introspection{}
+	client, err := oaUC.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return inactive, err
+	}
+	token, err := oaUC.jwtServ.ParseToken(raw)
+	if err != nil || oaUC.jwtServ.IsExpired(token) {
+		return inactive, nil
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	sid, _ := claims["sid"].(string)
+	session, err := oaUC.userRepo.GetSession(sid)
+	if err != nil || session.ClientID != client.ID {
+		return inactive, nil
+	}
+	user, err := oaUC.userRepo.GetUserByID(session.UserID)
+	if err != nil {
+		return inactive, nil
+	}
+
+	result := Domain.Introspection{
+		Active:   true,
+		Scope:    strings.Join(session.Scopes, " "),
+		ClientID: client.ID,
+		Subject:  user.ID,
+		Username: user.Username,
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		result.Exp = int64(exp)
+	}
+	switch claims["type"] {
+	case "access":
+		jti, _ := claims["jti"].(string)
+		if revoked, err := oaUC.revoked.IsRevoked(jti); err != nil || revoked {
+			return inactive, err
+		}
+		result.TokenType = "access_token"
+	case "refresh":
+		stored, err := oaUC.userRepo.GetRefreshToken(hashToken(raw))
+		if err != nil || stored.Used || stored.Revoked {
+			return inactive, nil
+		}
+		result.TokenType = "refresh_token"
+	default:
+		return inactive, nil
+	}
+	return result, nil
+}
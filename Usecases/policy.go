@@ -0,0 +1,153 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"log"
+	"sync"
+	"time"
+)
+
+// How long role definitions are cached before being read from the database again
+const roleCacheTTL = 30 * time.Second
+
+// Policy decides who may do what. Resources are the Blog, Media or User
+// being acted on, or nil for actions that don't target a record.
+// Everything beyond ownership comes from the permissions of the user's roles.
+type Policy struct {
+	roles    Domain.RoleRepositoryI
+	mu       sync.Mutex
+	cache    map[string][]string
+	loadedAt time.Time
+}
+
+func NewPolicy(roles Domain.RoleRepositoryI) *Policy {
+	return &Policy{
+		roles: roles,
+	}
+}
+
+func (p *Policy) Can(user Domain.User, action string, resource interface{}) bool {
+	switch r := resource.(type) {
+	case Domain.Blog:
+		owner := user.ID != "" && r.OwnerID == user.ID
+		coAuthor := isCoAuthor(r, user.ID)
+		switch action {
+		case Domain.ActionBlogCreate:
+			return owner
+		case Domain.ActionBlogRead:
+			return isPublished(r) || owner || coAuthor || p.HasPermission(user, Domain.PermBlogReview) || p.HasPermission(user, Domain.PermBlogModerate)
+		case Domain.ActionBlogComment:
+			return user.ID != "" && isPublished(r)
+		case Domain.ActionBlogUpdate, Domain.ActionBlogSubmit, Domain.ActionBlogCover:
+			return owner || coAuthor || p.HasPermission(user, Domain.PermBlogModerate)
+		case Domain.ActionBlogDelete, Domain.ActionBlogRestore, Domain.ActionBlogPurge, Domain.ActionBlogCoAuthors:
+			return owner || p.HasPermission(user, Domain.PermBlogModerate)
+		case Domain.ActionBlogPublish:
+			return owner || coAuthor || p.HasPermission(user, Domain.PermBlogPublish)
+		case Domain.ActionBlogViewReviews:
+			return owner || coAuthor || p.HasPermission(user, Domain.PermBlogReview)
+		case Domain.ActionBlogReview:
+			return p.HasPermission(user, Domain.PermBlogReview)
+		}
+	case Domain.Media:
+		switch action {
+		case Domain.ActionMediaUse:
+			return user.ID != "" && r.OwnerID == user.ID
+		case Domain.ActionMediaDelete:
+			return (user.ID != "" && r.OwnerID == user.ID) || p.HasPermission(user, Domain.PermMediaModerate)
+		}
+	case Domain.User:
+		switch action {
+		case Domain.ActionUserUpdate:
+			return r.ID == user.ID
+		case Domain.ActionUserRole:
+			return p.canManage(user, r) && p.HasPermission(user, Domain.PermRoleAssign)
+		case Domain.ActionUserManage:
+			return p.canManage(user, r) && p.HasPermission(user, Domain.PermUserManage)
+		case Domain.ActionUserSuspend:
+			return r.ID != user.ID && p.canManage(user, r) && p.HasPermission(user, Domain.PermUserBan)
+		}
+	case nil:
+		switch action {
+		case Domain.ActionBlogQueue:
+			return p.HasPermission(user, Domain.PermBlogReview)
+		case Domain.ActionRoleManage:
+			return p.HasPermission(user, Domain.PermRoleManage)
+		}
+	}
+	return false
+}
+
+func (p *Policy) HasPermission(user Domain.User, permission string) bool {
+	perms := p.permissions()
+	for _, role := range RoleNames(user) {
+		for _, granted := range perms[role] {
+			if granted == permission || granted == Domain.PermAll {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canManage keeps admins with full access out of reach of anyone with less
+func (p *Policy) canManage(user, target Domain.User) bool {
+	return !p.HasPermission(target, Domain.PermAll) || p.HasPermission(user, Domain.PermAll)
+}
+
+func (p *Policy) permissions() map[string][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache != nil && time.Since(p.loadedAt) < roleCacheTTL {
+		return p.cache
+	}
+	roles, err := p.roles.GetRoles()
+	if err != nil {
+		// Keep serving the last known roles rather than locking everyone out
+		log.Print("failed to load roles: ", err)
+		if p.cache == nil {
+			return map[string][]string{}
+		}
+		return p.cache
+	}
+	p.cache = make(map[string][]string, len(roles))
+	for _, role := range roles {
+		p.cache[role.Name] = role.Permissions
+	}
+	p.loadedAt = time.Now()
+	return p.cache
+}
+
+// Invalidate drops cached roles so changes apply on the next check
+func (p *Policy) Invalidate() {
+	p.mu.Lock()
+	p.cache = nil
+	p.mu.Unlock()
+}
+
+// RoleNames returns the roles of a user, falling back to the legacy single
+// role field for accounts created before multiple roles existed
+func RoleNames(user Domain.User) []string {
+	if len(user.Roles) > 0 {
+		return user.Roles
+	}
+	if user.Role != "" {
+		return []string{user.Role}
+	}
+	return []string{"user"}
+}
+
+// isPublished tells whether readers can see the blog. Blogs created before
+// the review workflow have no status and stay public.
+func isPublished(blog Domain.Blog) bool {
+	return blog.DeletedAt == nil && (blog.Status == Domain.StatusPublished || blog.Status == "")
+}
+
+func isCoAuthor(blog Domain.Blog, userID string) bool {
+	for _, coAuthor := range blog.CoAuthors {
+		if userID != "" && coAuthor == userID {
+			return true
+		}
+	}
+	return false
+}
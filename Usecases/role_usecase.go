@@ -0,0 +1,195 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"regexp"
+	"slices"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Roles created on startup when missing so existing "user"/"editor"/"admin"
+// accounts keep working
+var defaultRoles = []Domain.Role{
+	{Name: "user", Description: "Regular reader and author"},
+	{Name: "editor", Description: "Reviews and publishes blogs", Permissions: []string{Domain.PermBlogReview, Domain.PermBlogPublish, Domain.PermCommentModerate}},
+	{Name: "admin", Description: "Full access", Permissions: []string{Domain.PermAll}},
+}
+
+type RoleUseCase struct {
+	repo     Domain.RoleRepositoryI
+	userRepo Domain.UserRepositoryI
+	policy   Domain.PolicyI
+	audit    auditLog
+}
+
+func NewRoleUseCase(r Domain.RoleRepositoryI, ur Domain.UserRepositoryI, pl Domain.PolicyI, ar Domain.AuditRepositoryI) *RoleUseCase {
+	return &RoleUseCase{
+		repo:     r,
+		userRepo: ur,
+		policy:   pl,
+		audit:    auditLog{repo: ar},
+	}
+}
+
+func (ru *RoleUseCase) EnsureDefaultRolesUC() error {
+	for _, role := range defaultRoles {
+		if err := ru.repo.InsertRoleIfMissing(role); err != nil {
+			return err
+		}
+	}
+	ru.policy.Invalidate()
+	return nil
+}
+
+func (ru *RoleUseCase) ListRolesUC() ([]Domain.Role, error) {
+	return ru.repo.GetRoles()
+}
+
+func (ru *RoleUseCase) SaveRoleUC(actor Domain.User, role Domain.Role) error {
+	if !ru.policy.Can(actor, Domain.ActionRoleManage, nil) {
+		return Domain.ErrForbidden
+	}
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("invalid role name")
+	}
+	// The built-in roles decide who is an admin at all
+	if isBuiltInRole(role.Name) && !ru.policy.HasPermission(actor, Domain.PermAll) {
+		return Domain.ErrForbidden
+	}
+	for _, perm := range role.Permissions {
+		if !isKnownPermission(perm) {
+			return errors.New("unknown permission: " + perm)
+		}
+	}
+	if !holdsAll(ru.policy, actor, role.Permissions) {
+		return Domain.ErrForbidden
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	// A new role has nothing to show before the change
+	var before any
+	if existing, err := ru.repo.GetRole(role.Name); err == nil {
+		// Taking permissions away is as much a change to them as handing them out
+		if !holdsAll(ru.policy, actor, existing.Permissions) {
+			return Domain.ErrForbidden
+		}
+		before = roleSnapshot(existing)
+	}
+	if err := ru.repo.UpsertRole(role); err != nil {
+		return err
+	}
+	ru.policy.Invalidate()
+	ru.audit.record(actor, Domain.AuditRoleSave, "role", role.Name, before, roleSnapshot(role))
+	return nil
+}
+
+func (ru *RoleUseCase) DeleteRoleUC(actor Domain.User, name string) error {
+	if !ru.policy.Can(actor, Domain.ActionRoleManage, nil) {
+		return Domain.ErrForbidden
+	}
+	if isBuiltInRole(name) {
+		return errors.New("built-in roles can not be deleted")
+	}
+	count, err := ru.repo.CountUsersWithRole(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("role is still assigned to users")
+	}
+	var before any
+	if existing, err := ru.repo.GetRole(name); err == nil {
+		before = roleSnapshot(existing)
+	}
+	if err := ru.repo.DeleteRole(name); err != nil {
+		return err
+	}
+	ru.policy.Invalidate()
+	ru.audit.record(actor, Domain.AuditRoleDelete, "role", name, before, nil)
+	return nil
+}
+
+func (ru *RoleUseCase) AssignRolesUC(actor Domain.User, email string, roles []string) (*Domain.User, error) {
+	target, err := ru.userRepo.GetUserByEmail(email)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !ru.policy.Can(actor, Domain.ActionUserRole, *target) {
+		return nil, Domain.ErrForbidden
+	}
+	if len(roles) == 0 {
+		return nil, errors.New("at least one role is required")
+	}
+	if err := checkRoleChange(ru.policy, ru.repo, actor, RoleNames(*target), roles); err != nil {
+		return nil, err
+	}
+	updated, err := ru.userRepo.UpdateUserRoles(email, roles)
+	if err != nil {
+		return nil, err
+	}
+	ru.audit.record(actor, Domain.AuditUserRoles, "user", target.ID, userSnapshot(*target), userSnapshot(*updated))
+	return updated, nil
+}
+
+// checkRoleChange makes sure every role granted or taken away exists and
+// carries only permissions the actor holds, so no one can hand out more than
+// they have
+func checkRoleChange(pl Domain.PolicyI, rr Domain.RoleRepositoryI, actor Domain.User, from, to []string) error {
+	changed := []string{}
+	for _, name := range to {
+		if !slices.Contains(from, name) {
+			changed = append(changed, name)
+		}
+	}
+	for _, name := range from {
+		if !slices.Contains(to, name) {
+			changed = append(changed, name)
+		}
+	}
+	for _, name := range changed {
+		role, err := rr.GetRole(name)
+		if err != nil {
+			if slices.Contains(to, name) {
+				return errors.New("invalid role")
+			}
+			// A role that no longer exists grants nothing and can always go
+			continue
+		}
+		if !holdsAll(pl, actor, role.Permissions) {
+			return Domain.ErrForbidden
+		}
+	}
+	return nil
+}
+
+func holdsAll(pl Domain.PolicyI, user Domain.User, permissions []string) bool {
+	for _, perm := range permissions {
+		if !pl.HasPermission(user, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBuiltInRole(name string) bool {
+	return name == "user" || name == "admin"
+}
+
+func roleSnapshot(role Domain.Role) map[string]any {
+	return map[string]any{
+		"description": role.Description,
+		"permissions": role.Permissions,
+	}
+}
+
+func isKnownPermission(perm string) bool {
+	for _, known := range Domain.Permissions {
+		if perm == known {
+			return true
+		}
+	}
+	return false
+}
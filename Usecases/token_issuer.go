@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// Matches the lifetime of the refresh JWT
+const refreshTokenTTL = 24 * time.Hour
+
+// tokenIssuer starts sessions and rotates their refresh tokens, both for our
+// own logins and for OAuth clients acting for a user
+type tokenIssuer struct {
+	repo    Domain.UserRepositoryI
+	jwtServ Domain.JwtServI
+}
+
+// startSession records a new signed in device and issues its first token pair.
+// Sessions of OAuth clients carry the client and the scopes the user granted.
+func (ti tokenIssuer) startSession(user Domain.User, device Domain.DeviceInfo, clientID string, scopes []string) (map[string]string, error) {
+	if err := checkSuspension(user); err != nil {
+		return make(map[string]string), err
+	}
+	now := time.Now()
+	session := Domain.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		ClientID:   clientID,
+		Scopes:     scopes,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+	if err := ti.repo.CreateSession(session); err != nil {
+		return make(map[string]string), err
+	}
+	return ti.issueTokens(user, session, device)
+}
+
+// issueTokens creates a token pair and stores the hashed refresh token in the session's family
+func (ti tokenIssuer) issueTokens(user Domain.User, session Domain.Session, device Domain.DeviceInfo) (map[string]string, error) {
+	tokens, err := ti.jwtServ.CreateToken(user, session)
+	if err != nil {
+		return tokens, err
+	}
+	now := time.Now()
+	tokenData := Domain.RefreshTokenStorage{
+		UserID:    user.ID,
+		TokenHash: hashToken(tokens["refresh_token"]),
+		FamilyID:  session.ID,
+		UserAgent: device.UserAgent,
+		IP:        device.IP,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	if err := ti.repo.StoreToken(tokenData); err != nil {
+		return make(map[string]string), err
+	}
+	return tokens, nil
+}
+
+// refresh rotates a refresh token. A token may only be refreshed by the
+// client its session was started for, clientID is empty for our own logins.
+func (ti tokenIssuer) refresh(refreshToken, clientID string, device Domain.DeviceInfo) (map[string]string, error) {
+	tokens := make(map[string]string)
+	token, err := ti.jwtServ.ParseToken(refreshToken)
+	if err != nil {
+		return tokens, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["type"] != "refresh" {
+		return tokens, errors.New("invalid refresh token")
+	}
+	stored, err := ti.repo.GetRefreshToken(hashToken(refreshToken))
+	if err != nil || stored.Revoked {
+		return tokens, errors.New("invalid refresh token")
+	}
+	if stored.Used {
+		// A rotated token came back, so it was copied. Sign out every holder of the family.
+		if err := ti.repo.RevokeSession(stored.FamilyID); err != nil {
+			return tokens, err
+		}
+		return tokens, errors.New("refresh token reuse detected, please login again")
+	}
+	if ti.jwtServ.IsExpired(token) || time.Now().After(stored.ExpiresAt) {
+		return tokens, errors.New("refresh Token expired try to login again")
+	}
+	session, err := ti.repo.GetSession(stored.FamilyID)
+	if err != nil || session.ClientID != clientID {
+		return tokens, errors.New("invalid refresh token")
+	}
+	marked, err := ti.repo.MarkRefreshTokenUsed(stored.TokenHash)
+	if err != nil {
+		return tokens, err
+	}
+	if !marked {
+		if err := ti.repo.RevokeSession(stored.FamilyID); err != nil {
+			return tokens, err
+		}
+		return tokens, errors.New("refresh token reuse detected, please login again")
+	}
+
+	user, err := ti.repo.GetUserByID(stored.UserID)
+	if err != nil {
+		return tokens, err
+	}
+	if err := checkSuspension(*user); err != nil {
+		return tokens, err
+	}
+	if err := ti.repo.TouchSession(stored.FamilyID, device); err != nil {
+		return tokens, err
+	}
+	return ti.issueTokens(*user, session, device)
+}
+
+// checkSuspension keeps suspended users from getting new tokens
+func checkSuspension(user Domain.User) error {
+	if user.Suspension.ActiveAt(time.Now()) {
+		return &Domain.SuspendedError{Reason: user.Suspension.Reason, Until: user.Suspension.Until}
+	}
+	return nil
+}
+
+// randomToken returns an unguessable url safe token
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Tokens are only ever stored as a sha256 digest
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
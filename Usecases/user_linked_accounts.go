@@ -0,0 +1,158 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markbates/goth"
+)
+
+// OauthCallbackUsecase signs in through an external provider. Known identities
+// sign into their account, an existing account is only joined when the
+// provider vouches for the email address, anyone else gets a new account.
+func (uc UserUsecase) OauthCallbackUsecase(identity *goth.User, device Domain.DeviceInfo) (map[string]string, error) {
+	if existing, err := uc.repo.GetUserByLinkedAccount(identity.Provider, identity.UserID); err == nil {
+		return uc.beginLogin(*existing, device)
+	}
+	if identity.Email == "" {
+		return make(map[string]string), errors.New("provider did not share an email address")
+	}
+	verified := providerVerifiedEmail(identity)
+	account := Domain.LinkedAccount{Provider: identity.Provider, Subject: identity.UserID, Email: identity.Email, LinkedAt: time.Now()}
+
+	if existing, err := uc.repo.GetUserByEmail(identity.Email); err == nil {
+		if !verified {
+			return make(map[string]string), errors.New("an account with this email already exists, sign in and link the provider from your account")
+		}
+		if !existing.Verfied {
+			// Whoever registered the unverified account never proved they own the address
+			if err := uc.repo.UpdatePassword(existing.ID, "", nil); err != nil {
+				return make(map[string]string), err
+			}
+			if err := uc.repo.RevokeSessions(existing.ID, ""); err != nil {
+				return make(map[string]string), err
+			}
+			if err := uc.repo.SetVerified(existing.Email); err != nil {
+				return make(map[string]string), err
+			}
+			existing.Verfied = true
+		}
+		if err := uc.repo.AddLinkedAccount(existing.ID, account); err != nil {
+			return make(map[string]string), err
+		}
+		return uc.beginLogin(*existing, device)
+	}
+
+	newUser := Domain.User{
+		ID:             uuid.New().String(),
+		Username:       providerUsername(identity),
+		Email:          identity.Email,
+		Verfied:        verified,
+		Provider:       identity.Provider,
+		Role:           "user",
+		Roles:          []string{"user"},
+		LinkedAccounts: []Domain.LinkedAccount{account},
+		CreatedAt:      time.Now(),
+	}
+	if err := uc.repo.Register(&newUser); err != nil {
+		return make(map[string]string), err
+	}
+	return uc.startSession(newUser, device)
+}
+
+// CreateLinkTokenUC returns a short lived token that carries the signed in
+// user through the provider's redirect
+func (uc UserUsecase) CreateLinkTokenUC(email, provider string) (string, error) {
+	if _, err := goth.GetProvider(provider); err != nil {
+		return "", errors.New("unknown provider")
+	}
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return "", errors.New("user not found")
+	}
+	if linkedAccount(*user, provider) != nil {
+		return "", errors.New("provider already linked")
+	}
+	return uc.jwtServ.CreateChallengeToken(*user, "link")
+}
+
+// LinkProviderUC adds the provider identity to the user the link token was made for
+func (uc UserUsecase) LinkProviderUC(linkToken string, identity *goth.User) error {
+	challenge, userID, ok := uc.readChallenge(linkToken, "link")
+	if !ok {
+		return errors.New("invalid or expired link token")
+	}
+	user, err := uc.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if linkedAccount(*user, identity.Provider) != nil {
+		return errors.New("provider already linked")
+	}
+	if _, err := uc.repo.GetUserByLinkedAccount(identity.Provider, identity.UserID); err == nil {
+		return errors.New("this provider account is already linked to another user")
+	}
+	if err := uc.revoked.Revoke(challenge); err != nil {
+		return err
+	}
+	account := Domain.LinkedAccount{Provider: identity.Provider, Subject: identity.UserID, Email: identity.Email, LinkedAt: time.Now()}
+	if err := uc.repo.AddLinkedAccount(user.ID, account); err != nil {
+		return err
+	}
+	if !user.Verfied && strings.EqualFold(identity.Email, user.Email) && providerVerifiedEmail(identity) {
+		return uc.repo.SetVerified(user.Email)
+	}
+	return nil
+}
+
+// UnlinkProviderUC refuses to remove the last way to sign in
+func (uc UserUsecase) UnlinkProviderUC(email, provider string) error {
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if linkedAccount(*user, provider) == nil {
+		return errors.New("provider not linked")
+	}
+	if user.Password == "" && len(user.LinkedAccounts) <= 1 {
+		return errors.New("set a password before unlinking your last sign in method")
+	}
+	return uc.repo.RemoveLinkedAccount(user.ID, provider)
+}
+
+func linkedAccount(user Domain.User, provider string) *Domain.LinkedAccount {
+	for i := range user.LinkedAccounts {
+		if user.LinkedAccounts[i].Provider == provider {
+			return &user.LinkedAccounts[i]
+		}
+	}
+	return nil
+}
+
+// providerVerifiedEmail reports whether the provider vouches for the email address
+func providerVerifiedEmail(identity *goth.User) bool {
+	switch identity.Provider {
+	case "github", "gitlab":
+		// Both only hand out addresses the user confirmed
+		return true
+	case "google":
+		verified, _ := identity.RawData["verified_email"].(bool)
+		return verified
+	default:
+		// OpenID Connect providers state it in a claim, Microsoft does not at all
+		verified, _ := identity.RawData["email_verified"].(bool)
+		return verified
+	}
+}
+
+func providerUsername(identity *goth.User) string {
+	for _, name := range []string{identity.NickName, identity.Name} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return strings.Split(identity.Email, "@")[0]
+}
@@ -0,0 +1,80 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	// Links one address can be sent per magicLinkTTL
+	magicLinkLimit = 3
+)
+
+// RequestMagicLinkUC answers the same whether or not the address has an
+// account, so it can't be used to find out who is registered
+func (uc UserUsecase) RequestMagicLinkUC(email string) error {
+	if !isValidEmail(email) {
+		return errors.New("invalid email")
+	}
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	sent, err := uc.repo.CountMagicLinks(email, now.Add(-magicLinkTTL))
+	if err != nil {
+		return err
+	}
+	if sent >= magicLinkLimit {
+		log.Printf("magic link limit reached for %s", email)
+		return nil
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	link := Domain.MagicLink{UserID: user.ID, Email: email, TokenHash: hashToken(token), CreatedAt: now, ExpiresAt: now.Add(magicLinkTTL)}
+	if err := uc.repo.StoreMagicLink(link); err != nil {
+		return err
+	}
+	// Sending in the background keeps the response time the same for unknown addresses
+	go func() {
+		if err := uc.mailer.SendMagicLinkEmail(email, token); err != nil {
+			log.Print("failed to send magic link: ", err)
+		}
+	}()
+	return nil
+}
+
+// CheckMagicLinkUC tells whether a link still works without using it up, so
+// mail scanners and link previews that open it don't sign anyone in
+func (uc UserUsecase) CheckMagicLinkUC(token string) (time.Time, error) {
+	link, err := uc.repo.GetMagicLink(hashToken(token))
+	if err != nil || time.Now().After(link.ExpiresAt) {
+		return time.Time{}, errors.New("invalid or expired link")
+	}
+	return link.ExpiresAt, nil
+}
+
+// MagicLinkLoginUC exchanges a link token for a normal login
+func (uc UserUsecase) MagicLinkLoginUC(token string, device Domain.DeviceInfo) (map[string]string, error) {
+	link, err := uc.repo.ConsumeMagicLink(hashToken(token))
+	if err != nil || time.Now().After(link.ExpiresAt) {
+		return make(map[string]string), errors.New("invalid or expired link")
+	}
+	user, err := uc.repo.GetUserByID(link.UserID)
+	if err != nil {
+		return make(map[string]string), errors.New("invalid or expired link")
+	}
+	// Opening the link proves the address belongs to the user
+	if !user.Verfied {
+		if err := uc.repo.SetVerified(user.Email); err != nil {
+			return make(map[string]string), err
+		}
+		user.Verfied = true
+	}
+	return uc.beginLogin(*user, device)
+}
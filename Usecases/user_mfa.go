@@ -0,0 +1,177 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	recoveryCodeCount = 10
+	// Wrong second factor codes allowed before the account is locked for mfaLockout
+	mfaMaxAttempts = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+// beginLogin hands out tokens, or only a challenge when the account has a second factor
+func (uc UserUsecase) beginLogin(user Domain.User, device Domain.DeviceInfo) (map[string]string, error) {
+	// Checked before the second factor too, so a suspended user isn't asked for a code
+	if err := checkSuspension(user); err != nil {
+		return make(map[string]string), err
+	}
+	if !user.TOTPEnabled {
+		return uc.startSession(user, device)
+	}
+	challenge, err := uc.jwtServ.CreateChallengeToken(user, "mfa")
+	if err != nil {
+		return make(map[string]string), err
+	}
+	return map[string]string{"mfa_required": "true", "mfa_token": challenge}, nil
+}
+
+// EnrollTOTPUC starts enrollment and returns the secret with its otpauth URI.
+// Two factor stays off until the first code is confirmed.
+func (uc UserUsecase) EnrollTOTPUC(email string) (string, string, error) {
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return "", "", errors.New("user not found")
+	}
+	if user.TOTPEnabled {
+		return "", "", errors.New("two factor authentication already enabled")
+	}
+	secret, err := uc.totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := uc.repo.SetTOTP(user.ID, secret, false, nil); err != nil {
+		return "", "", err
+	}
+	return secret, uc.totp.URI(secret, email), nil
+}
+
+// ConfirmTOTPUC turns two factor on and returns the recovery codes, which are
+// only ever shown this once
+func (uc UserUsecase) ConfirmTOTPUC(user Domain.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, errors.New("two factor authentication already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New("no two factor enrollment pending")
+	}
+	step, ok := uc.totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid two factor code")
+	}
+	codes, err := uc.totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashToken(normalizeRecoveryCode(c))
+	}
+	if err := uc.repo.SetTOTP(user.ID, user.TOTPSecret, true, hashes); err != nil {
+		return nil, err
+	}
+	if _, err := uc.repo.ConsumeTOTPStep(user.ID, step); err != nil {
+		return nil, err
+	}
+	uc.audit.record(user, Domain.AuditTOTPEnable, "user", user.ID, nil, nil)
+	return codes, nil
+}
+
+func (uc UserUsecase) DisableTOTPUC(user Domain.User, code string) error {
+	if !user.TOTPEnabled {
+		return errors.New("two factor authentication not enabled")
+	}
+	if err := uc.verifySecondFactor(user, code); err != nil {
+		return err
+	}
+	if err := uc.repo.SetTOTP(user.ID, "", false, nil); err != nil {
+		return err
+	}
+	uc.audit.record(user, Domain.AuditTOTPDisable, "user", user.ID, nil, nil)
+	return nil
+}
+
+// CompleteMFALoginUC exchanges the login challenge and a TOTP or recovery code for tokens
+func (uc UserUsecase) CompleteMFALoginUC(mfaToken, code string, device Domain.DeviceInfo) (map[string]string, error) {
+	tokens := make(map[string]string)
+	challenge, userID, ok := uc.readChallenge(mfaToken, "mfa")
+	if !ok {
+		return tokens, errors.New("invalid mfa token")
+	}
+	user, err := uc.repo.GetUserByID(userID)
+	if err != nil || !user.TOTPEnabled {
+		return tokens, errors.New("invalid mfa token")
+	}
+	if err := uc.verifySecondFactor(*user, code); err != nil {
+		return tokens, err
+	}
+	if err := uc.revoked.Revoke(challenge); err != nil {
+		return tokens, err
+	}
+	return uc.startSession(*user, device)
+}
+
+// readChallenge checks a challenge token of the given purpose that was not used yet
+// and returns the ID of the user it was made for. Callers revoke the returned
+// token once the step it proves is done.
+func (uc UserUsecase) readChallenge(raw, purpose string) (Domain.RevokedToken, string, bool) {
+	token, err := uc.jwtServ.ParseToken(raw)
+	if err != nil || uc.jwtServ.IsExpired(token) {
+		return Domain.RevokedToken{}, "", false
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	userID, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	exp, _ := claims["exp"].(float64)
+	// Challenges without a user ID only name an address, which may have changed hands
+	if claims["type"] != purpose || jti == "" || userID == "" || uc.IsTokenRevoked(jti) {
+		return Domain.RevokedToken{}, "", false
+	}
+	return Domain.RevokedToken{JTI: jti, Email: email, ExpiresAt: time.Unix(int64(exp), 0)}, userID, true
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code,
+// locking the second factor after too many wrong attempts
+func (uc UserUsecase) verifySecondFactor(user Domain.User, code string) error {
+	if time.Now().Before(user.MFALockedUntil) {
+		return errors.New("too many attempts, try again later")
+	}
+	ok, err := uc.checkSecondFactor(user, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return uc.repo.ResetMFAFailures(user.ID)
+	}
+	failures, err := uc.repo.IncrementMFAFailures(user.ID)
+	if err != nil {
+		return err
+	}
+	if failures >= mfaMaxAttempts {
+		if err := uc.repo.LockMFA(user.ID, time.Now().Add(mfaLockout)); err != nil {
+			return err
+		}
+		return errors.New("too many attempts, try again later")
+	}
+	return errors.New("invalid two factor code")
+}
+
+func (uc UserUsecase) checkSecondFactor(user Domain.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := uc.totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		return uc.repo.ConsumeTOTPStep(user.ID, step)
+	}
+	return uc.repo.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// Recovery codes are accepted with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
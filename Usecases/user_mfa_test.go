@@ -0,0 +1,145 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"testing"
+	"time"
+)
+
+// mfaRepo keeps the second factor state of one user the way UserRepository
+// does: a step is only accepted past the last one and a recovery code is
+// pulled when used
+type mfaRepo struct {
+	Domain.UserRepositoryI
+	lastStep      int64
+	recoveryCodes []string
+	failures      int
+	lockedUntil   time.Time
+}
+
+func (r *mfaRepo) ConsumeTOTPStep(id string, step int64) (bool, error) {
+	if step <= r.lastStep {
+		return false, nil
+	}
+	r.lastStep = step
+	return true, nil
+}
+
+func (r *mfaRepo) UseRecoveryCode(id, codeHash string) (bool, error) {
+	for i, hash := range r.recoveryCodes {
+		if hash == codeHash {
+			r.recoveryCodes = append(r.recoveryCodes[:i], r.recoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *mfaRepo) IncrementMFAFailures(id string) (int, error) {
+	r.failures++
+	return r.failures, nil
+}
+
+func (r *mfaRepo) LockMFA(id string, until time.Time) error {
+	r.failures, r.lockedUntil = 0, until
+	return nil
+}
+
+func (r *mfaRepo) ResetMFAFailures(id string) error {
+	r.failures = 0
+	return nil
+}
+
+// stepTOTP accepts the codes it knows, each for its own time step
+type stepTOTP struct {
+	Domain.TOTPServiceI
+	steps map[string]int64
+}
+
+func (s stepTOTP) Validate(secret, code string, at time.Time) (int64, bool) {
+	step, ok := s.steps[code]
+	return step, ok
+}
+
+func newMFAUsecase(recoveryCodes ...string) (UserUsecase, *mfaRepo) {
+	repo := &mfaRepo{}
+	for _, code := range recoveryCodes {
+		repo.recoveryCodes = append(repo.recoveryCodes, hashToken(normalizeRecoveryCode(code)))
+	}
+	totp := stepTOTP{steps: map[string]int64{"111111": 100, "222222": 101, "333333": 99}}
+	return UserUsecase{repo: repo, totp: totp}, repo
+}
+
+func TestVerifySecondFactorTOTPReplay(t *testing.T) {
+	user := Domain.User{ID: "u1", TOTPEnabled: true, TOTPSecret: "secret"}
+	tests := []struct {
+		name  string
+		codes []string
+		// ok says which of the codes, in order, are accepted
+		ok []bool
+	}{
+		{"code used twice", []string{"111111", "111111"}, []bool{true, false}},
+		{"earlier step after a later one", []string{"111111", "333333"}, []bool{true, false}},
+		{"later step after an earlier one", []string{"111111", "222222"}, []bool{true, true}},
+		{"each step once", []string{"333333", "111111", "222222", "222222"}, []bool{true, true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newMFAUsecase()
+			for i, code := range tt.codes {
+				err := uc.verifySecondFactor(user, code)
+				if (err == nil) != tt.ok[i] {
+					t.Errorf("code %d (%s): err = %v, want accepted = %v", i, code, err, tt.ok[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifySecondFactorRecoveryCodes(t *testing.T) {
+	user := Domain.User{ID: "u1", TOTPEnabled: true, TOTPSecret: "secret"}
+	tests := []struct {
+		name  string
+		codes []string
+		ok    []bool
+	}{
+		{"code used twice", []string{"abcde-fghij", "abcde-fghij"}, []bool{true, false}},
+		{"other spelling of a used code", []string{"ABCDE-FGHIJ", "abcdefghij"}, []bool{true, false}},
+		{"other codes stay usable", []string{"abcde-fghij", "klmno-pqrst", "abcde-fghij"}, []bool{true, true, false}},
+		{"unknown code", []string{"zzzzz-zzzzz"}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, repo := newMFAUsecase("abcde-fghij", "klmno-pqrst")
+			for i, code := range tt.codes {
+				err := uc.verifySecondFactor(user, code)
+				if (err == nil) != tt.ok[i] {
+					t.Errorf("code %d (%s): err = %v, want accepted = %v", i, code, err, tt.ok[i])
+				}
+			}
+			used := 0
+			for _, ok := range tt.ok {
+				if ok {
+					used++
+				}
+			}
+			if len(repo.recoveryCodes) != 2-used {
+				t.Errorf("%d recovery codes left, want %d", len(repo.recoveryCodes), 2-used)
+			}
+		})
+	}
+}
+
+func TestVerifySecondFactorReplaysCountAsFailures(t *testing.T) {
+	user := Domain.User{ID: "u1", TOTPEnabled: true, TOTPSecret: "secret"}
+	uc, repo := newMFAUsecase()
+	if err := uc.verifySecondFactor(user, "111111"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < mfaMaxAttempts; i++ {
+		uc.verifySecondFactor(user, "111111")
+	}
+	if !repo.lockedUntil.After(time.Now()) {
+		t.Error("replaying a code did not lock the second factor")
+	}
+}
@@ -0,0 +1,92 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	otpTTL = 10 * time.Minute
+	// Wrong codes allowed before verification is locked for otpLockout
+	otpMaxAttempts = 5
+	otpLockout     = 15 * time.Minute
+	// Time to wait before another code can be sent
+	otpResendCooldown = time.Minute
+)
+
+// newOTP puts a fresh code on the user and returns it, only its hash is kept
+func (uc UserUsecase) newOTP(user *Domain.User) string {
+	otp := uc.otpGen.GenerateOTP()
+	now := time.Now()
+	user.OTPHash = hashToken(otp)
+	user.OTPExpiresAt = now.Add(otpTTL)
+	user.OTPSentAt = now
+	user.OTPFailures = 0
+	return otp
+}
+
+func (uc UserUsecase) sendOTP(email, otp string) error {
+	if err := uc.mailer.SendOTPEmail(email, otp); err != nil {
+		log.Print(err.Error())
+		return errors.New("error while sending otp email")
+	}
+	return nil
+}
+
+// VerifyOTPUsecase verifies the account's email. Wrong codes count towards a
+// lockout, after which a new code has to be requested.
+func (uc UserUsecase) VerifyOTPUsecase(email, otp string) error {
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.Verfied {
+		return errors.New("email already verified")
+	}
+	if time.Now().Before(user.OTPLockedUntil) {
+		return errors.New("too many attempts, try again later")
+	}
+	if user.OTPHash == "" || time.Now().After(user.OTPExpiresAt) {
+		return errors.New("expired otp code")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(strings.TrimSpace(otp))), []byte(user.OTPHash)) != 1 {
+		failures, err := uc.repo.IncrementOTPFailures(email)
+		if err != nil {
+			return err
+		}
+		if failures >= otpMaxAttempts {
+			if err := uc.repo.LockOTP(email, time.Now().Add(otpLockout)); err != nil {
+				return err
+			}
+			return errors.New("too many attempts, try again later")
+		}
+		return errors.New("invalid otp code")
+	}
+	return uc.repo.SetVerified(email)
+}
+
+// ResendOTPUsecase replaces the code of an unverified account
+func (uc UserUsecase) ResendOTPUsecase(email string) error {
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.Verfied {
+		return errors.New("email already verified")
+	}
+	if time.Now().Before(user.OTPLockedUntil) {
+		return errors.New("too many attempts, try again later")
+	}
+	if time.Since(user.OTPSentAt) < otpResendCooldown {
+		return errors.New("please wait before requesting another code")
+	}
+	otp := uc.newOTP(user)
+	if err := uc.repo.SetOTP(email, user.OTPHash, user.OTPExpiresAt); err != nil {
+		return err
+	}
+	return uc.sendOTP(email, otp)
+}
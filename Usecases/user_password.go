@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"blog_api/Domain"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How long an emailed reset link works
+const resetTokenTTL = 30 * time.Minute
+
+func (uc UserUsecase) ForgotPasswordUsecase(email string) error {
+	if !isValidEmail(email) {
+		return errors.New("invalid email")
+	}
+
+	user, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	reset := Domain.ResetTokenS{UserID: user.ID, Email: email, TokenHash: hashToken(token), CreatedAt: now, ExpiresAt: now.Add(resetTokenTTL)}
+	if err := uc.repo.StoreResetToken(reset); err != nil {
+		return err
+	}
+	return uc.mailer.SendResetPassEmail(email, token, resetTokenTTL)
+}
+
+// ResetPasswordUsecase sets a new password with an emailed reset token. The
+// token works once and every session is signed out afterwards.
+func (uc UserUsecase) ResetPasswordUsecase(token, newPassword string, device Domain.DeviceInfo) error {
+	tokenHash := hashToken(token)
+	reset, err := uc.repo.GetResetToken(tokenHash)
+	if err != nil || time.Now().After(reset.ExpiresAt) {
+		return errors.New("invalid token")
+	}
+	user, err := uc.repo.GetUserByID(reset.UserID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	// A rejected password leaves the token usable for another try
+	if err := uc.checkNewPassword(*user, newPassword); err != nil {
+		return err
+	}
+	consumed, err := uc.repo.ConsumeResetToken(tokenHash)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return errors.New("invalid token")
+	}
+	if err := uc.setPassword(*user, newPassword); err != nil {
+		return err
+	}
+	actor := *user
+	actor.Device = device
+	uc.audit.record(actor, Domain.AuditPasswordReset, "user", user.ID, nil, nil)
+	// Whoever knew the old password must not stay signed in, nor keep the
+	// access tokens they may have created with it
+	if err := uc.repo.RevokeSessions(user.ID, ""); err != nil {
+		return err
+	}
+	_, err = uc.tokens.DeleteAccessTokens(user.ID)
+	return err
+}
+
+// ChangePasswordUC replaces the password of a signed in user. Every other
+// session is signed out, the one that made the change stays.
+func (uc UserUsecase) ChangePasswordUC(user Domain.User, sessionID, currentPassword, newPassword string) error {
+	if user.Password == "" {
+		return errors.New("account has no password, use forgot password to set one")
+	}
+	// Guesses here count against the same lockout as logins, a stolen token
+	// must not become a way around it
+	if err := uc.checkLoginThrottle(user.Email, user.Device.IP); err != nil {
+		return err
+	}
+	if !uc.pass_serv.Compare(user.Password, currentPassword) {
+		uc.loginFailed(user.Email, user.Device.IP, &user)
+		return errors.New("invalid current password")
+	}
+	if err := uc.attempts.Reset(accountKey(user.Email)); err != nil {
+		return err
+	}
+	if err := uc.checkNewPassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := uc.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	uc.audit.record(user, Domain.AuditPasswordChange, "user", user.ID, nil, nil)
+	return uc.repo.RevokeSessions(user.ID, sessionID)
+}
+
+// checkNewPassword applies the password policy, which also rules out the
+// current password and the ones before it
+func (uc UserUsecase) checkNewPassword(user Domain.User, password string) error {
+	policyErr := &Domain.PasswordPolicyError{}
+	if err := uc.passwords.Check(password); err != nil && !errors.As(err, &policyErr) {
+		return err
+	}
+	if uc.reusesPassword(user, password) {
+		policyErr.Violations = append(policyErr.Violations, Domain.PasswordViolation{
+			Rule:    Domain.PasswordRuleReused,
+			Message: fmt.Sprintf("must not be one of your last %d passwords", uc.passwords.History()),
+		})
+	}
+	if len(policyErr.Violations) > 0 {
+		return policyErr
+	}
+	return nil
+}
+
+func (uc UserUsecase) reusesPassword(user Domain.User, password string) bool {
+	recent := user.PasswordHistory
+	if user.Password != "" {
+		recent = append([]string{user.Password}, recent...)
+	}
+	for _, hash := range recent[:min(len(recent), uc.passwords.History())] {
+		if uc.pass_serv.Compare(hash, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// setPassword stores the new hash and keeps the replaced one for the reuse rule
+func (uc UserUsecase) setPassword(user Domain.User, password string) error {
+	hashed, err := uc.pass_serv.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	history := user.PasswordHistory
+	if user.Password != "" {
+		history = append([]string{user.Password}, history...)
+	}
+	// The new password is one of the last History() passwords itself
+	history = history[:min(len(history), max(uc.passwords.History()-1, 0))]
+	return uc.repo.UpdatePassword(user.ID, string(hashed), history)
+}
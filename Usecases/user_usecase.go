@@ -5,10 +5,9 @@ import (
 	"errors"
 	"log"
 	"time"
-	"unicode"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/markbates/goth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
 type UserUsecase struct {
@@ -17,101 +16,51 @@ type UserUsecase struct {
 	mailer    Domain.MailerI
 	otpGen    Domain.GeneratorI
 	jwtServ   Domain.JwtServI
+	policy    Domain.PolicyI
+	roles     Domain.RoleRepositoryI
+	revoked   Domain.RevocationListI
+	totp      Domain.TOTPServiceI
+	attempts  Domain.LoginAttemptRepositoryI
+	passwords Domain.PasswordPolicyI
+	audit     auditLog
+	tokens    Domain.AccessTokenRepositoryI
 }
 
-func NewUserUsecase(r Domain.UserRepositoryI, ps Domain.PasswordServiceI, mailr Domain.MailerI, og Domain.GeneratorI, jt Domain.JwtServI) UserUsecase {
+func NewUserUsecase(r Domain.UserRepositoryI, ps Domain.PasswordServiceI, mailr Domain.MailerI, og Domain.GeneratorI, jt Domain.JwtServI, pl Domain.PolicyI, rr Domain.RoleRepositoryI, rl Domain.RevocationListI, tp Domain.TOTPServiceI, la Domain.LoginAttemptRepositoryI, pp Domain.PasswordPolicyI, ar Domain.AuditRepositoryI, tr Domain.AccessTokenRepositoryI) UserUsecase {
 	return UserUsecase{
 		repo:      r,
 		pass_serv: ps,
 		mailer:    mailr,
 		otpGen:    og,
 		jwtServ:   jt,
+		policy:    pl,
+		roles:     rr,
+		revoked:   rl,
+		totp:      tp,
+		attempts:  la,
+		passwords: pp,
+		audit:     auditLog{repo: ar},
+		tokens:    tr,
 	}
 }
 
-func (uc UserUsecase) ResetPasswordUsecase(data Domain.ResetTokenS) error {
-	if !isValidEmail(data.Email) {
-		return errors.New("invalid email")
-	}
-
-	if uc.repo.CheckExistence(data.Email) != nil {
-		return errors.New("user not found")
-	}
-
-	existingData, err := uc.repo.GetTokenData(data.Email)
-	if err != nil {
-		return err
-	}
-	// Check token expiry and validity
-	if data.Created_at.Sub(existingData.Created_at).Minutes() > 10 || data.Token != existingData.Token {
-		uc.repo.DeleteTokenData(data.Email)
-		return errors.New("invalid token")
-	}
-
-	// validate and update password
-	if !isValidPassword(data.NewPassword) {
-		return errors.New("invalid password")
-	}
-	hashed, err := uc.pass_serv.HashPassword(data.NewPassword)
-	if err != nil {
-		return err
-	}
-	return uc.repo.UpdatePassword(data.Email, string(hashed))
+// startSession signs the user in on a new device
+func (uc UserUsecase) startSession(user Domain.User, device Domain.DeviceInfo) (map[string]string, error) {
+	return uc.issuer().startSession(user, device, "", nil)
 }
 
-func (uc UserUsecase) OauthCallbackUsecase(user *goth.User) (map[string]string, error) {
-
-	if uc.repo.CheckExistence(user.Email) == nil {
-		// Handle login since user already exists
-		existingUser, err := uc.repo.GetUserByEmail(user.Email)
-		if err != nil {
-			return make(map[string]string), err
-		}
-		// Get token using jwt
-		tokens, err := uc.jwtServ.CreateToken(*existingUser)
-		if err != nil {
-			return make(map[string]string), err
-		}
-		return tokens, nil
-	} else {
-		// Register the user into the database and login the user
-		var newUser Domain.User
-		newUser.Email = user.Email
-		err := uc.repo.Register(&newUser)
-		if err != nil {
-			return make(map[string]string), err
-		}
-		tokens, err := uc.jwtServ.CreateToken(newUser)
-		if err != nil {
-			return make(map[string]string), err
-		}
-		return tokens, nil
-	}
+func (uc UserUsecase) issuer() tokenIssuer {
+	return tokenIssuer{repo: uc.repo, jwtServ: uc.jwtServ}
 }
 
-func (uc UserUsecase) ForgotPasswordUsecase(email string) error {
-	if !isValidEmail(email) {
+func (uc UserUsecase) RegisterUsecase(user *Domain.User) error {
+	// Check if user has valid credentials before moving on to insert into db
+	if !isValidEmail(user.Email) {
 		return errors.New("invalid email")
 	}
-
-	if uc.repo.CheckExistence(email) != nil {
-		return errors.New("user not found")
-	}
-
-	reset_token := uc.otpGen.GenerateOTP()
-	err := uc.mailer.SendResetPassEmail(email, reset_token)
-	if err != nil {
+	if err := uc.passwords.Check(user.Password); err != nil {
 		return err
 	}
-	data := Domain.ResetTokenS{Token: reset_token, Email: email, Created_at: time.Now()}
-	return uc.repo.ForgotPassword(data)
-}
-
-func (uc UserUsecase) RegisterUsecase(user *Domain.User) error {
-	// Check if user has valid credentials before moving on to insert into db
-	if !isValidEmail(user.Email) || !isValidPassword(user.Password) {
-		return errors.New("invalid email or password")
-	}
 	if uc.repo.CheckExistence(user.Email) == nil {
 		return errors.New("email already exists in database")
 	}
@@ -119,72 +68,43 @@ func (uc UserUsecase) RegisterUsecase(user *Domain.User) error {
 	if err != nil {
 		return err
 	}
-	if !user.Verfied {
-		otp := uc.otpGen.GenerateOTP()
-		user.OTP = otp
-		user.OTPTime = time.Now()
-		err = uc.mailer.SendOTPEmail(user.Email, otp)
-		if err != nil {
-			log.Print(err.Error())
-			return errors.New("error while sending otp email")
-		}
-	}
 	user.Password = string(new_p)
+	// Only the emailed code can verify an account
+	user.Verfied = false
+	if err := uc.sendOTP(user.Email, uc.newOTP(user)); err != nil {
+		return err
+	}
+	user.ID = uuid.New().String()
+	user.CreatedAt = time.Now()
+	// Roles are only ever granted by an admin
+	user.Role = "user"
+	user.Roles = []string{"user"}
 	return uc.repo.Register(user)
 }
 
-func (uc UserUsecase) LoginUsecase(user *Domain.User) (map[string]string, error) {
+func (uc UserUsecase) LoginUsecase(user *Domain.User, device Domain.DeviceInfo) (map[string]string, error) {
 	var tokens map[string]string
+	if err := uc.checkLoginThrottle(user.Email, device.IP); err != nil {
+		return tokens, err
+	}
 	existingUser, err := uc.repo.GetUser(user)
 	if err != nil {
+		uc.loginFailed(user.Email, device.IP, nil)
 		return tokens, errors.New("user not found")
 	}
 
 	if !uc.pass_serv.Compare(existingUser.Password, user.Password) {
+		uc.loginFailed(user.Email, device.IP, existingUser)
 		return tokens, errors.New("invalid password or email")
 	}
-	tokens, err = uc.jwtServ.CreateToken(*user)
-	if err != nil {
-		return tokens, err
-	}
-	tokenData := Domain.RefreshTokenStorage{
-		Email: user.Email,
-		Token: tokens["refresh_token"],
-	}
-	if err = uc.repo.DeleteToken(user.Email); err != nil {
+	if err := uc.attempts.Reset(accountKey(user.Email)); err != nil {
 		return tokens, err
 	}
-	if err = uc.repo.DeleteFromBlackList(user.Email); err != nil {
-		return tokens, err
-	}
-	if err = uc.repo.StoreToken(tokenData); err != nil {
-		return tokens, err
-	}
-	// Get token using jwt
-	return tokens, nil
-}
-
-func (uc UserUsecase) VerifyOTPUsecase(user *Domain.User) error {
-	existingUser, err := uc.repo.GetUser(user)
-	if err != nil {
-		return errors.New("user not found")
-	}
-	if (user.OTPTime.Sub(existingUser.OTPTime)).Minutes() > 5 {
-		err := uc.repo.DeleteUser(existingUser.Email)
-		if err != nil {
-			return err
-		}
-		return errors.New("expired otp code please register again")
-	}
-	if user.OTP != existingUser.OTP {
-		err := uc.repo.DeleteUser(existingUser.Email)
-		if err != nil {
-			return err
-		}
-		return errors.New("invalid otp code, please register again")
+	if !existingUser.Verfied {
+		return tokens, errors.New("email not verified")
 	}
-	existingUser.Verfied = true
-	return uc.repo.UpdateUser(existingUser)
+	// Every login starts its own session so other devices stay signed in
+	return uc.beginLogin(*existingUser, device)
 }
 
 func (uc UserUsecase) GetUserByEmail(email string) (*Domain.User, error) {
@@ -197,8 +117,25 @@ func (uc UserUsecase) GetUserByEmail(email string) (*Domain.User, error) {
 	return user, nil
 }
 
-func (uc UserUsecase) UpdateProfileUsecase(user *Domain.User) (*Domain.User, error) {
-	user, err := uc.repo.UpdateUserProfile(user)
+func (uc UserUsecase) GetUserByID(id string) (*Domain.User, error) {
+	return uc.repo.GetUserByID(id)
+}
+
+func (uc UserUsecase) UpdateProfileUsecase(actor Domain.User, update Domain.User) (*Domain.User, error) {
+	user, err := uc.repo.GetUserByID(update.ID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !uc.policy.Can(actor, Domain.ActionUserUpdate, *user) {
+		return nil, Domain.ErrForbidden
+	}
+	if update.Username != "" {
+		user.Username = update.Username
+	}
+	if update.Bio != "" {
+		user.Bio = update.Bio
+	}
+	user, err = uc.repo.UpdateUserProfile(user)
 
 	if err != nil {
 		return nil, err
@@ -207,11 +144,32 @@ func (uc UserUsecase) UpdateProfileUsecase(user *Domain.User) (*Domain.User, err
 	return user, nil
 }
 
-func (uc UserUsecase) UpdateUserRole(email string, role string) (*Domain.User, error) {
-	if role != "user" && role != "admin" {
-		return nil, errors.New("invalid role")
+func (uc UserUsecase) UpdateUserRole(actor Domain.User, email string, role string) (*Domain.User, error) {
+	target, err := uc.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !uc.policy.Can(actor, Domain.ActionUserRole, *target) {
+		return nil, Domain.ErrForbidden
+	}
+	if err := checkRoleChange(uc.policy, uc.roles, actor, RoleNames(*target), []string{role}); err != nil {
+		return nil, err
+	}
+	updated, err := uc.repo.UpdateUserRole(email, role)
+	if err != nil {
+		return nil, err
 	}
-	return uc.repo.UpdateUserRole(email, role)
+	uc.audit.record(actor, Domain.AuditUserRole, "user", target.ID, userSnapshot(*target), userSnapshot(*updated))
+	return updated, nil
+}
+
+// PublicKeysUC lists the keys other services can verify our tokens with
+func (uc UserUsecase) PublicKeysUC() []Domain.JWK {
+	return uc.jwtServ.PublicKeys()
+}
+
+func (uc UserUsecase) HasPermission(user Domain.User, permission string) bool {
+	return uc.policy.HasPermission(user, permission)
 }
 
 // email validation function
@@ -240,71 +198,68 @@ func isValidEmail(email string) bool {
 	return hasDot
 }
 
-// Password validation function
-func isValidPassword(pass string) bool {
-	upper := 0
-	lower := 0
-	special := 0
-	digit := 0
-
-	for _, char := range pass {
-		if unicode.IsDigit(char) {
-			digit += 1
-		} else if unicode.IsUpper(char) {
-			upper += 1
-		} else if unicode.IsLower(char) {
-			lower += 1
-		} else {
-			special += 1
-		}
-	}
-	return (len(pass) >= 8 && upper > 0 && special > 0 && lower > 0 && digit > 0)
+func (uc UserUsecase) RefreshUseCase(refreshToken string, device Domain.DeviceInfo) (map[string]string, error) {
+	// Tokens of OAuth clients are refreshed at /oauth/token with client credentials
+	return uc.issuer().refresh(refreshToken, "", device)
 }
 
-func (uc UserUsecase) RefreshUseCase(refreshToken string) (map[string]string, error) {
-	tokens := make(map[string]string)
-	token, err := uc.jwtServ.ParseToken(refreshToken)
-	if err != nil {
-		return tokens, err
+func (uc UserUsecase) LogoutUseCase(user Domain.User, sessionID, access_token string) error {
+	var err error
+	if sessionID != "" {
+		err = uc.repo.RevokeSession(sessionID)
+	} else {
+		// tokens issued before sessions existed can only sign out everywhere
+		err = uc.repo.DeleteToken(user.ID)
 	}
-	claims := token.Claims.(jwt.MapClaims)
-	userEmail := claims["email"].(string)
-	existingToken, err := uc.repo.GetRefreshToken(userEmail)
 	if err != nil {
-		return tokens, err
-	}
-	if existingToken != refreshToken {
-		return tokens, errors.New("invalid refresh token")
-	}
-	if uc.jwtServ.IsExpired(token) {
-		return tokens, errors.New("refresh Token expired try to login again")
-	}
-	if err := uc.repo.DeleteToken(userEmail); err != nil {
-		return tokens, err
+		return err
 	}
+	return uc.revokeAccessToken(user.Email, access_token)
+}
 
-	user, err := uc.repo.GetUserByEmail(userEmail)
-	if err != nil {
-		return tokens, err
-	}
-	tokens, err = uc.jwtServ.CreateToken(*user)
+// revokeAccessToken blocks the token until it would have expired on its own
+func (uc UserUsecase) revokeAccessToken(email, accessToken string) error {
+	token, err := uc.jwtServ.ParseToken(accessToken)
 	if err != nil {
-		return tokens, err
+		return err
 	}
-	if err = uc.repo.StoreToken(Domain.RefreshTokenStorage{Token: tokens["refresh_token"], Email: userEmail}); err != nil {
-		return tokens, err
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		// Older tokens cannot be revoked one by one, they run out within the hour
+		return nil
 	}
-	return tokens, err
+	return uc.revoked.Revoke(Domain.RevokedToken{JTI: jti, Email: email, ExpiresAt: time.Unix(int64(exp), 0)})
 }
 
-func (uc UserUsecase) LogoutUseCase(email, access_token string) error {
-	err := uc.repo.DeleteToken(email)
-	if err != nil {
-		return err
+func (uc UserUsecase) ListSessionsUC(userID string) ([]Domain.Session, error) {
+	return uc.repo.GetSessions(userID)
+}
+
+func (uc UserUsecase) RevokeSessionUC(userID, id string) error {
+	session, err := uc.repo.GetSession(id)
+	if err != nil || session.UserID != userID {
+		return errors.New("session not found")
 	}
-	return uc.repo.AddToBlackList(access_token, email)
+	return uc.repo.RevokeSession(id)
 }
 
-func (uc UserUsecase) RetriveFromBlackList(email string) (string, error) {
-	return uc.repo.RetriveFromBlackList(email)
+func (uc UserUsecase) RevokeOtherSessionsUC(userID, currentID string) error {
+	return uc.repo.RevokeSessions(userID, currentID)
+}
+
+func (uc UserUsecase) IsSessionActive(id string) bool {
+	_, err := uc.repo.GetSession(id)
+	return err == nil
+}
+
+// IsTokenRevoked fails closed, a token is refused when the list can't be read
+func (uc UserUsecase) IsTokenRevoked(jti string) bool {
+	revoked, err := uc.revoked.IsRevoked(jti)
+	if err != nil {
+		log.Print("failed to check revoked tokens: ", err)
+		return true
+	}
+	return revoked
 }